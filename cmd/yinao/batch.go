@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 使用加密记录文件，对名单文件中的每个患者进行查询，输出CSV格式的报告
+func runBatch(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("batch", "[-json] [-o 报告文件] [-secret 密钥文件] [-half-life 天数] [-max-age 天数] [-no-index] -list 名单文件 加密记录文件...", stderr)
+	lf := addLoadFlags(fs, true)
+	listFile := fs.String("list", "", "名单文件（CSV或者TSV格式），每行一个患者的基本信息和（或）身份证号，可以带有“姓名”、“性别”、“出生年份”、“身份证号”等表头")
+	outFile := fs.String("o", "", "保存报告的文件，不指定时输出到标准输出")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || len(*listFile) == 0 {
+		fs.Usage()
+		return exitError
+	}
+	if err := checkExist(*listFile, false); err != nil {
+		return fail(stderr, err)
+	}
+	rows, err := db.ReadBatchFile(*listFile)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	yinaoDB, err := loadDB(fs.Args(), lf)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	defer yinaoDB.Close()
+	results, err := yinaoDB.SearchBatch(rows)
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	out := stdout
+	if len(*outFile) != 0 {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	matched, invalid := 0, 0
+	jsonList := make([]map[string]interface{}, len(results))
+	for i, res := range results {
+		if len(res.Matches) != 0 {
+			matched++
+		}
+		if len(res.Errors) != 0 {
+			invalid++
+		}
+		recList := make([]*db.RecordJSON, len(res.Matches))
+		for j, rec := range res.Matches {
+			recList[j] = rec.ToJSON()
+		}
+		jsonList[i] = map[string]interface{}{
+			"line":      res.Line,
+			"base_info": res.BaseInfo,
+			"id":        res.ID,
+			"errors":    res.Errors,
+			"records":   recList,
+		}
+	}
+	if *asJSON {
+		err = writeJSON(out, map[string]interface{}{
+			"rows":    len(results),
+			"matched": matched,
+			"invalid": invalid,
+			"results": jsonList,
+		})
+	} else {
+		err = db.WriteBatchReport(out, results)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if !*asJSON {
+		fmt.Fprintf(stderr, "共查询%d行，其中%d行查询到记录，%d行输入有误\n", len(results), matched, invalid)
+	}
+	if matched == 0 {
+		return exitNoMatch
+	}
+	return exitOK
+}
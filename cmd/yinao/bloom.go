@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 用加密记录文件中的记录生成布隆过滤器，供只需要初步筛查的诊所使用，过滤器中不包含任何描述
+func runBloom(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("bloom", "[-json] [-hash 哈希方案] [-secret 密钥文件] [-fp 误报率] -o 输出文件 加密记录文件...", stderr)
+	outFile := fs.String("o", "", "保存布隆过滤器的输出文件，必须指定")
+	hf := addHashFlags(fs, true)
+	fpRate := fs.Float64("fp", db.DefaultFalsePositiveRate, "误报率，即没有记录的患者被报告为可能有记录的概率")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || len(*outFile) == 0 {
+		fs.Usage()
+		return exitError
+	}
+	hasher, err := hf.hasher()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	records := db.NewRecordsWithScheme(hasher.Scheme())
+	var errLog bytes.Buffer
+	for _, fname := range fs.Args() {
+		if err := checkExist(fname, false); err != nil {
+			return fail(stderr, err)
+		}
+		if err := records.AddEncRecordsInFile(fname, 0, &errLog); err != nil {
+			return fail(stderr, err)
+		}
+	}
+	if errLog.Len() != 0 {
+		stderr.Write(errLog.Bytes())
+		return fail(stderr, fmt.Errorf("读取记录时发现错误，布隆过滤器不会被保存。"))
+	}
+	filter, err := records.BloomFilter(*fpRate)
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	if !strings.HasSuffix(*outFile, db.BloomFileSuffix) {
+		*outFile = *outFile + db.BloomFileSuffix
+	}
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	err = filter.WriteToFile(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"output":              *outFile,
+			"hashes":              filter.Count,
+			"false_positive_rate": filter.FalsePositiveRate(),
+		})
+	} else {
+		fmt.Fprintf(stdout, "布隆过滤器已生成，共%d个哈希值，误报率约为%g，输出文件位于：%s\n", filter.Count, filter.FalsePositiveRate(), *outFile)
+	}
+	return exitOK
+}
+
+// 使用布隆过滤器，按基本信息或者身份证号进行初步筛查，只报告是否可能有记录
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("check", "[-json] [-secret 密钥文件] (-info 基本信息 | -id 身份证号 [-name 姓名]) 布隆过滤器文件...", stderr)
+	hf := addHashFlags(fs, false)
+	info := fs.String("info", "", "基本信息，格式为“姓名，性别，出生年份”，会同时筛查出生年份加一和减一的记录")
+	id := fs.String("id", "", "身份证号")
+	name := fs.String("name", "", "患者的姓名，与-id一起指定时，还会用身份证号中的性别和出生年份按基本信息进行筛查")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || (len(*info) == 0) == (len(*id) == 0) || (len(*name) != 0 && len(*id) == 0) {
+		fs.Usage()
+		return exitError
+	}
+	secret, err := hf.secret()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	var matched []string
+	for _, fname := range fs.Args() {
+		if err := checkExist(fname, false); err != nil {
+			return fail(stderr, err)
+		}
+		filter, err := db.LoadBloomFilter(fname, secret)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		var ok bool
+		if len(*info) != 0 {
+			ok, err = filter.MayContainBaseInfo(*info)
+		} else if len(*name) != 0 {
+			ok, err = filter.MayContainIDWithName(*id, *name)
+		} else {
+			ok, err = filter.MayContainID(*id)
+		}
+		if err != nil {
+			return fail(stderr, err)
+		}
+		if ok {
+			matched = append(matched, fname)
+		}
+	}
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"possible_match": len(matched) != 0,
+			"files":          matched,
+		})
+	} else if len(matched) != 0 {
+		fmt.Fprintf(stdout, "可能有记录（来自%s），请向网络中的其他医院查询详细信息\n", strings.Join(matched, "、"))
+	} else {
+		fmt.Fprintln(stdout, "没有记录")
+	}
+	if len(matched) == 0 {
+		return exitNoMatch
+	}
+	return exitOK
+}
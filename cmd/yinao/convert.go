@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 将原始记录文件，或者CSV、TSV表格文件转为加密记录文件
+func runConvert(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("convert", "[-json] [-encrypt-desc] [-fill-from-id] [-encoding 编码] [-columns 各列的含义] [-hash 哈希方案] [-secret 密钥文件] [-creator 创建者] [-sign-key 私钥文件] [-o 输出文件] 原始记录文件或表格文件", stderr)
+	outFile := fs.String("o", "", "输出文件，默认与原始记录文件位于同一目录，以"+db.EncFileSuffix+"结尾")
+	hf := addHashFlags(fs, true)
+	creator := fs.String("creator", "", "写入文件头部的创建者，可以为空")
+	signKeyFile := fs.String("sign-key", "", "贡献者的签名私钥文件，指定时对每条记录签名")
+	encryptDesc := fs.Bool("encrypt-desc", false, "加密对医闹行为的描述，只有知道患者基本信息或身份证号的人才能看到")
+	fillFromID := fs.Bool("fill-from-id", false, "基本信息中只写了姓名，或者留空了性别、出生年份时，用身份证号补全它们")
+	encoding := fs.String("encoding", db.EncodingAuto, "原始记录文件的编码：auto（自动识别）、utf-8、gbk、gb18030、utf-16le或utf-16be")
+	columns := fs.String("columns", "", "表格文件中各列的含义，例如name=1,gender=2,year=3,id=4,confidence=5,description=6，等号后面也可以是表头中的列名，默认按表头识别")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+	fname := fs.Arg(0)
+	if err := checkExist(fname, false); err != nil {
+		return fail(stderr, err)
+	}
+	ext := strings.ToLower(filepath.Ext(fname))
+	if ext != ".txt" && ext != ".csv" && ext != ".tsv" {
+		return fail(stderr, fmt.Errorf("%s 不是文本文件或者表格文件，无法进行处理。", fname))
+	}
+	hasher, err := hf.hasher()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	var mapping map[string]string
+	if len(*columns) != 0 {
+		if mapping, err = db.ParseColumnMapping(*columns); err != nil {
+			return fail(stderr, err)
+		}
+	}
+	signingKey, err := readSigningKey(*signKeyFile)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	opts := &db.ConvertOptions{
+		Hasher:             hasher,
+		Creator:            *creator,
+		EncryptDescription: *encryptDesc,
+		SigningKey:         signingKey,
+		PublishDate:        time.Now(),
+		FillFromID:         *fillFromID,
+		Encoding:           *encoding,
+	}
+	var recList []*db.Record
+	if ext == ".txt" {
+		recList, err = db.ExtractRecordsFromRawFileWithOptions(fname, opts)
+	} else {
+		recList, err = db.ExtractRecordsFromCSVFile(fname, mapping, opts)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if len(*outFile) == 0 {
+		*outFile = fname[:len(fname)-len(ext)] + db.EncFileSuffix
+	}
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	err = db.WriteRecordsToFileWithHeader(opts.Header(), recList, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"input":   fname,
+			"output":  *outFile,
+			"records": len(recList),
+		})
+	} else {
+		fmt.Fprintf(stdout, "转换成功，共%d条记录，输出文件位于：%s\n", len(recList), *outFile)
+	}
+	return exitOK
+}
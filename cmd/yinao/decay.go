@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 与置信参数随时间衰减有关的参数
+type decayFlags struct {
+	halfLife *int
+	maxAge   *int
+}
+
+// 增加-max-age参数，withHalfLife为true时同时增加-half-life参数
+func addDecayFlags(fs *flag.FlagSet, withHalfLife bool) *decayFlags {
+	df := &decayFlags{halfLife: new(int)}
+	if withHalfLife {
+		df.halfLife = fs.Int("half-life", 0, "置信参数减半所需的天数，按事件日期（没有时按发布日期）计算，为0时不衰减")
+	}
+	df.maxAge = fs.Int("max-age", 0, "丢弃超过这个天数的记录，为0时不丢弃；没有日期的记录不会被丢弃")
+	return df
+}
+
+// 根据参数创建衰减策略，没有指定任何参数时返回nil
+func (df *decayFlags) policy() (*db.DecayPolicy, error) {
+	if *df.halfLife < 0 || *df.maxAge < 0 {
+		return nil, fmt.Errorf("天数不能是负数")
+	}
+	if *df.halfLife == 0 && *df.maxAge == 0 {
+		return nil, nil
+	}
+	return db.NewDecayPolicy(*df.halfLife, *df.maxAge), nil
+}
@@ -0,0 +1,143 @@
+// yinao是医闹黑名单的命令行版本，它不需要图形界面，便于在没有显示器的服务器上用脚本执行转换、合并和查询
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	exitOK      = 0 // 执行成功，对于查询而言表示查询到了记录
+	exitNoMatch = 1 // 查询执行成功，但没有查询到记录
+	exitError   = 2 // 参数错误或者执行时遇到错误
+)
+
+const usage = `用法：yinao <子命令> [参数]
+
+子命令：
+  convert    将原始记录文件转为加密记录文件
+  merge      扫描并且合并加密记录文件
+  retract    为自己发布过的记录生成撤回记录
+  load       载入加密记录文件，检查其中是否有错误
+  query      使用加密记录文件或者查询服务进行查询
+  batch      使用加密记录文件，对名单文件中的患者逐个进行查询
+  serve      载入加密记录文件，提供HTTP/JSON查询服务
+  export     将加密记录文件中的记录以NDJSON格式导出
+  import     将NDJSON格式的记录导入为加密记录文件
+  pack       将加密记录文件转为体积更小的二进制格式（.yinao.bin）
+  unpack     将二进制格式的加密记录文件转回文本格式
+  bloom      用加密记录文件生成布隆过滤器（.yinao.bloom），其中不包含任何描述
+  check      使用布隆过滤器进行初步筛查，只报告是否可能有记录
+  psi        与另一家医院进行隐私集合求交，只得知双方共有的患者
+  gensecret  随机生成一个群组密钥，用于带密钥的哈希方案
+  keygen     随机生成一个贡献者的签名私钥，用于对记录签名
+
+执行 yinao <子命令> -h 可以查看各子命令的参数。
+退出码：0表示成功（查询时表示查询到了记录），1表示没有查询到记录，2表示出错。
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// 根据子命令执行相应的功能，返回值为进程的退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	var fn func(args []string, stdout, stderr io.Writer) int
+	switch args[0] {
+	case "convert":
+		fn = runConvert
+	case "merge":
+		fn = runMerge
+	case "retract":
+		fn = runRetract
+	case "load":
+		fn = runLoad
+	case "query":
+		fn = runQuery
+	case "batch":
+		fn = runBatch
+	case "serve":
+		fn = runServe
+	case "export":
+		fn = runExport
+	case "import":
+		fn = runImport
+	case "pack":
+		fn = runPack
+	case "unpack":
+		fn = runUnpack
+	case "bloom":
+		fn = runBloom
+	case "check":
+		fn = runCheck
+	case "psi":
+		fn = runPSI
+	case "gensecret":
+		fn = runGenSecret
+	case "keygen":
+		fn = runKeyGen
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "未知的子命令：%s\n\n%s", args[0], usage)
+		return exitError
+	}
+	return fn(args[1:], stdout, stderr)
+}
+
+// 创建子命令的参数解析器，argsUsage是对非选项参数的说明
+func newFlagSet(name, argsUsage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "用法：yinao %s %s\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// 解析子命令的参数，出错时返回对应的退出码
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK, false
+	}
+	if err != nil {
+		return exitError, false
+	}
+	return exitOK, true
+}
+
+// 输出错误信息，并返回出错时的退出码
+func fail(stderr io.Writer, err error) int {
+	fmt.Fprintf(stderr, "错误！%s\n", err.Error())
+	return exitError
+}
+
+// 以JSON格式输出结果
+func writeJSON(stdout io.Writer, v interface{}) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// 检查某文件或者目录是否存在
+func checkExist(path string, isDir bool) error {
+	t := "文件"
+	if isDir {
+		t = "目录"
+	}
+	if fileInfo, err := os.Stat(path); err != nil || fileInfo.IsDir() != isDir {
+		return fmt.Errorf("不存在的%s：'%s'", t, path)
+	}
+	return nil
+}
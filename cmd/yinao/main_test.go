@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+	"github.com/YinaoBlacklist/YinaoBlacklist/server"
+)
+
+var rawTxt = `
+张若虚，男，2019
+11010920190401961X
+19.0
+春江潮水连海平，海上明月共潮生。
+滟滟随波千万里，何处春江无月明？
+
+张若美，女，2018
+11010920180401984X
+98.0
+江流宛转绕芳甸，月照花林皆似霰。
+空里流霜不觉飞，汀上白沙看不见。`
+
+func runCmd(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "a"), os.ModePerm)
+	rawFile := filepath.Join(dir, "a", "raw.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+
+	code, _, _ := runCmd()
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("nosuchcmd")
+	assert.Equal(t, exitError, code)
+
+	code, out, _ := runCmd("convert", "-json", rawFile)
+	assert.Equal(t, exitOK, code)
+	var convertRes struct {
+		Output  string `json:"output"`
+		Records int    `json:"records"`
+	}
+	assert.Equal(t, nil, json.Unmarshal([]byte(out), &convertRes))
+	assert.Equal(t, filepath.Join(dir, "a", "raw.yinao.txt"), convertRes.Output)
+	assert.Equal(t, 2, convertRes.Records)
+
+	mergedFile := filepath.Join(dir, "merged.yinao.txt")
+	code, _, _ = runCmd("merge", "-o", mergedFile, filepath.Join(dir, "a")+"=1000")
+	assert.Equal(t, exitOK, code)
+	code, _, _ = runCmd("merge", "-o", mergedFile, filepath.Join(dir, "a")+"=abc")
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("merge", "-o", mergedFile, filepath.Join(dir, "nosuchdir"))
+	assert.Equal(t, exitError, code)
+
+	code, out, _ = runCmd("load", mergedFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "2条记录")
+
+	code, out, _ = runCmd("query", "-json", "-info", "张若虚，男，2018", mergedFile)
+	assert.Equal(t, exitOK, code)
+	var queryRes struct {
+		Count   int `json:"count"`
+		Records []struct {
+			Confidence float32 `json:"confidence"`
+			FileName   string  `json:"file_name"`
+			BaseInfo   string  `json:"base_info"`
+		} `json:"records"`
+	}
+	assert.Equal(t, nil, json.Unmarshal([]byte(out), &queryRes))
+	assert.Equal(t, 1, queryRes.Count)
+	assert.Equal(t, float32(29.0), queryRes.Records[0].Confidence)
+	assert.Equal(t, mergedFile, queryRes.Records[0].FileName)
+	assert.Equal(t, "张若虚，男，2019", queryRes.Records[0].BaseInfo)
+
+	code, out, _ = runCmd("query", "-id", "11010920180401984X", mergedFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "11010920180401984X")
+	assert.Contains(t, out, "空里流霜不觉飞，汀上白沙看不见。")
+
+	code, out, _ = runCmd("query", "-id", "11010920170401921X", mergedFile)
+	assert.Equal(t, exitNoMatch, code)
+	assert.Equal(t, "没有查询到记录\n", out)
+
+	code, _, _ = runCmd("query", "-info", "张若虚,男，2019", mergedFile)
+	assert.Equal(t, exitOK, code)
+	code, _, _ = runCmd("query", "-info", "张若虚，男2019", mergedFile)
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("query", "-info", "张若虚，男，2019", "-id", "11010920180401984X", mergedFile)
+	assert.Equal(t, exitError, code)
+}
+
+func TestCLIWithSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	secretFile := filepath.Join(dir, "secret.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+
+	code, _, _ := runCmd("gensecret", "-o", secretFile)
+	assert.Equal(t, exitOK, code)
+	code, _, _ = runCmd("gensecret", "-o", secretFile)
+	assert.Equal(t, exitError, code)
+
+	code, _, _ = runCmd("convert", "-hash", "hmac-sha256", rawFile)
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("convert", "-secret", secretFile, rawFile)
+	assert.Equal(t, exitOK, code)
+
+	code, _, stderr := runCmd("query", "-id", "11010920180401984X", encFile)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "需要提供群组密钥")
+	code, _, _ = runCmd("query", "-secret", secretFile, "-id", "11010920180401984X", encFile)
+	assert.Equal(t, exitOK, code)
+
+	mergedFile := filepath.Join(dir, "merged.yinao.txt")
+	code, _, _ = runCmd("merge", "-o", mergedFile, dir)
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("merge", "-secret", secretFile, "-o", mergedFile, dir)
+	assert.Equal(t, exitOK, code)
+}
+
+func TestCLIWithArgon2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+
+	code, _, _ := runCmd("convert", "-hash", "argon2id/t=1,m=4,p=1", rawFile)
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("convert", "-hash", "argon2id/t=1,m=64,p=1", rawFile)
+	assert.Equal(t, exitOK, code)
+	code, _, _ = runCmd("query", "-info", "张若美，女，2018", encFile)
+	assert.Equal(t, exitOK, code)
+
+	mergedFile := filepath.Join(dir, "merged.yinao.txt")
+	code, _, _ = runCmd("merge", "-hash", "argon2id", "-o", mergedFile, dir)
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("merge", "-hash", "argon2id/t=1,m=64,p=1", "-o", mergedFile, dir)
+	assert.Equal(t, exitOK, code)
+}
+
+func TestCLIEncryptDescription(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+
+	code, _, _ := runCmd("convert", "-encrypt-desc", rawFile)
+	assert.Equal(t, exitOK, code)
+	dat, err := ioutil.ReadFile(encFile)
+	assert.Equal(t, nil, err)
+	assert.NotContains(t, string(dat), "空里流霜不觉飞")
+
+	code, out, _ := runCmd("query", "-id", "11010920180401984X", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "空里流霜不觉飞，汀上白沙看不见。")
+}
+
+func TestCLISign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	keyFile := filepath.Join(dir, "key.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+
+	code, out, _ := runCmd("keygen", "-json", "-o", keyFile)
+	assert.Equal(t, exitOK, code)
+	var keyRes struct {
+		PublicKey string `json:"public_key"`
+	}
+	assert.Equal(t, nil, json.Unmarshal([]byte(out), &keyRes))
+
+	code, _, _ = runCmd("convert", "-sign-key", keyFile, rawFile)
+	assert.Equal(t, exitOK, code)
+	code, out, _ = runCmd("query", "-id", "11010920180401984X", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "签名者："+keyRes.PublicKey)
+}
+
+func TestCLIKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	keyFile := filepath.Join(dir, "key.txt")
+	keyringFile := filepath.Join(dir, "keyring.txt")
+	outFile := filepath.Join(dir, "out.yinao.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+
+	code, out, _ := runCmd("keygen", "-json", "-o", keyFile)
+	assert.Equal(t, exitOK, code)
+	var keyRes struct {
+		PublicKey string `json:"public_key"`
+	}
+	assert.Equal(t, nil, json.Unmarshal([]byte(out), &keyRes))
+	code, _, _ = runCmd("convert", "-sign-key", keyFile, rawFile)
+	assert.Equal(t, exitOK, code)
+
+	err = ioutil.WriteFile(keyringFile, []byte(keyRes.PublicKey+" block\n"), 0644)
+	assert.Equal(t, nil, err)
+	code, out, _ = runCmd("merge", "-json", "-keyring", keyringFile, "-o", outFile, dir)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"records": 0`)
+	assert.NotContains(t, out, `"blocked": 0`)
+
+	err = ioutil.WriteFile(keyringFile, []byte("default allow\n"+keyRes.PublicKey+" 状态\n"), 0644)
+	assert.Equal(t, nil, err)
+	code, _, errOut := runCmd("merge", "-keyring", keyringFile, "-o", outFile, dir)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, errOut, "第2行")
+}
+
+func TestCLIRetract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "a"), os.ModePerm)
+	rawFile := filepath.Join(dir, "a", "raw.txt")
+	encFile := filepath.Join(dir, "a", "raw.yinao.txt")
+	keyFile := filepath.Join(dir, "key.txt")
+	tombFile := filepath.Join(dir, "a", "retract.yinao.txt")
+	mergedFile := filepath.Join(dir, "merged.yinao.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+
+	code, _, _ := runCmd("keygen", "-o", keyFile)
+	assert.Equal(t, exitOK, code)
+	code, _, _ = runCmd("convert", "-sign-key", keyFile, rawFile)
+	assert.Equal(t, exitOK, code)
+
+	// 不用私钥就不能撤回记录，用别人的私钥也不行
+	code, _, _ = runCmd("retract", "-id", "11010920180401984X", "-o", tombFile, encFile)
+	assert.Equal(t, exitError, code)
+	otherKey := filepath.Join(dir, "other.txt")
+	code, _, _ = runCmd("keygen", "-o", otherKey)
+	assert.Equal(t, exitOK, code)
+	code, _, _ = runCmd("retract", "-sign-key", otherKey, "-id", "11010920180401984X", "-o", tombFile, encFile)
+	assert.Equal(t, exitNoMatch, code)
+	code, out, _ := runCmd("retract", "-json", "-sign-key", keyFile, "-id", "11010920180401984X", "-o", tombFile, encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"records": 1`)
+
+	code, out, _ = runCmd("merge", "-json", "-o", mergedFile, filepath.Join(dir, "a"))
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"retracted": 1`)
+	code, _, _ = runCmd("query", "-id", "11010920180401984X", mergedFile)
+	assert.Equal(t, exitNoMatch, code)
+	code, _, _ = runCmd("query", "-id", "11010920180401984X", encFile, tombFile)
+	assert.Equal(t, exitNoMatch, code)
+	code, _, _ = runCmd("query", "-id", "11010920190401961X", mergedFile)
+	assert.Equal(t, exitOK, code)
+}
+
+func TestCLIDecay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	raw := "张若虚，男，2019\n11010920190401961X\n80.0\n日期：2000-01-01\n春江潮水连海平，海上明月共潮生。\n"
+	err = ioutil.WriteFile(rawFile, []byte(raw), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitOK, code)
+
+	code, out, _ := runCmd("query", "-id", "11010920190401961X", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "事件发生于2000-01-01，发布于")
+	code, out, _ = runCmd("query", "-json", "-half-life", "3650", "-id", "11010920190401961X", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.NotContains(t, out, `"confidence": 80`)
+	assert.Contains(t, out, `"age_days": `)
+	code, _, _ = runCmd("query", "-max-age", "3650", "-id", "11010920190401961X", encFile)
+	assert.Equal(t, exitNoMatch, code)
+	code, _, _ = runCmd("query", "-max-age", "-1", "-id", "11010920190401961X", encFile)
+	assert.Equal(t, exitError, code)
+
+	code, out, _ = runCmd("merge", "-json", "-max-age", "3650", "-o", filepath.Join(dir, "merged"), dir)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"expired": 1`)
+}
+
+func TestCLIIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitOK, code)
+
+	code, _, _ = runCmd("load", "-no-index", encFile)
+	assert.Equal(t, exitOK, code)
+	_, err = os.Stat(encFile + db.IndexFileSuffix)
+	assert.True(t, os.IsNotExist(err))
+	code, _, _ = runCmd("load", encFile)
+	assert.Equal(t, exitOK, code)
+	_, err = os.Stat(encFile + db.IndexFileSuffix)
+	assert.Equal(t, nil, err)
+	code, _, _ = runCmd("query", "-id", "11010920180401984X", encFile)
+	assert.Equal(t, exitOK, code)
+}
+
+func TestCLIBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	listFile := filepath.Join(dir, "list.tsv")
+	reportFile := filepath.Join(dir, "report.csv")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitOK, code)
+	list := "姓名\t性别\t出生年份\t身份证号\n张若虚\t男\t2018\t\n李四\t男\t1980\t123\n"
+	err = ioutil.WriteFile(listFile, []byte(list), 0644)
+	assert.Equal(t, nil, err)
+
+	code, _, stderr := runCmd("batch", "-list", listFile, "-o", reportFile, encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stderr, "共查询2行，其中1行查询到记录，1行输入有误")
+	report, err := ioutil.ReadFile(reportFile)
+	assert.Equal(t, nil, err)
+	assert.Contains(t, string(report), "2,张若虚，男，2018,,查询到记录,基本信息（出生年份相差一年）,19,")
+	assert.Contains(t, string(report), "3,李四，男，1980,123,输入有误,")
+
+	code, stdout, _ := runCmd("batch", "-json", "-list", listFile, encFile)
+	assert.Equal(t, exitOK, code)
+	var res struct {
+		Rows    int `json:"rows"`
+		Matched int `json:"matched"`
+	}
+	err = json.Unmarshal([]byte(stdout), &res)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, res.Rows)
+	assert.Equal(t, 1, res.Matched)
+
+	err = ioutil.WriteFile(listFile, []byte("李四，男，1980\n"), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ = runCmd("batch", "-list", listFile, encFile)
+	assert.Equal(t, exitNoMatch, code)
+}
+
+func TestCLIFillFromID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	txt := "\n张若美\n11010920180401984X\n98.0\n江流宛转绕芳甸，月照花林皆似霰。\n"
+	err = ioutil.WriteFile(rawFile, []byte(txt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("convert", "-fill-from-id", rawFile)
+	assert.Equal(t, exitOK, code)
+
+	code, out, _ := runCmd("query", "-info", "张若美，女，2018", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "江流宛转绕芳甸")
+	code, out, _ = runCmd("query", "-id", "11010920180401984X", "-name", "张若美", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "张若美，女，2018")
+	code, _, _ = runCmd("query", "-info", "张若美，女，2018", "-name", "张若美", encFile)
+	assert.Equal(t, exitError, code)
+}
+
+func TestCLIConvertCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	csvFile := filepath.Join(dir, "list.csv")
+	encFile := filepath.Join(dir, "list.yinao.txt")
+	txt := "张若美,女,2018,11010920180401984X,98,江流宛转绕芳甸，月照花林皆似霰。\n"
+	err = ioutil.WriteFile(csvFile, []byte(txt), 0644)
+	assert.Equal(t, nil, err)
+	// 没有表头时必须指定各列的含义
+	code, _, errOut := runCmd("convert", csvFile)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, errOut, "缺少这些列")
+	code, _, _ = runCmd("convert", "-columns", "name=1,gender=2,year=3,id=4,confidence=5,description=6", csvFile)
+	assert.Equal(t, exitOK, code)
+
+	code, out, _ := runCmd("query", "-id", "11010920180401984X", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "江流宛转绕芳甸")
+	code, _, _ = runCmd("convert", "-columns", "name=1,age=2", csvFile)
+	assert.Equal(t, exitError, code)
+}
+
+func TestCLINDJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	jsonFile := filepath.Join(dir, "raw.ndjson")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitOK, code)
+
+	code, out, _ := runCmd("export", encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"base_info_hash"`)
+	code, _, _ = runCmd("export", "-o", jsonFile, encFile)
+	assert.Equal(t, exitOK, code)
+
+	// 导出之后再导入，得到的文件可以查询到相同的记录
+	importedFile := filepath.Join(dir, "imported.yinao.txt")
+	code, _, _ = runCmd("import", "-o", importedFile, jsonFile)
+	assert.Equal(t, exitOK, code)
+	code, out, _ = runCmd("query", "-id", "11010920180401984X", importedFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "空里流霜不觉飞，汀上白沙看不见。")
+
+	code, _, _ = runCmd("import", "-hash", "argon2id", "-o", importedFile, jsonFile)
+	assert.Equal(t, exitError, code)
+	err = ioutil.WriteFile(jsonFile, []byte(out), 0644)
+	assert.Equal(t, nil, err)
+	code, _, errOut := runCmd("import", "-o", importedFile, jsonFile)
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, errOut, "导入时发现错误")
+}
+
+func TestCLIPack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	binFile := filepath.Join(dir, "raw.yinao.bin")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitOK, code)
+	expected, err := ioutil.ReadFile(encFile)
+	assert.Equal(t, nil, err)
+
+	code, _, _ = runCmd("pack", encFile)
+	assert.Equal(t, exitOK, code)
+	code, out, _ := runCmd("query", "-id", "11010920180401984X", binFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "空里流霜不觉飞，汀上白沙看不见。")
+	code, _, _ = runCmd("pack", binFile)
+	assert.Equal(t, exitError, code)
+
+	// 转回文本格式之后与原来的文件相同
+	os.Remove(encFile)
+	code, _, _ = runCmd("unpack", binFile)
+	assert.Equal(t, exitOK, code)
+	actual, err := ioutil.ReadFile(encFile)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	// 合并时输出文件以.yinao.bin结尾则输出二进制格式
+	os.Remove(encFile)
+	mergedFile := filepath.Join(dir, "merged.yinao.bin")
+	code, _, _ = runCmd("merge", "-o", mergedFile, dir)
+	assert.Equal(t, exitOK, code)
+	code, out, _ = runCmd("query", "-id", "11010920180401984X", mergedFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "空里流霜不觉飞，汀上白沙看不见。")
+}
+
+func TestCLIBloom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	bloomFile := filepath.Join(dir, "raw.yinao.bloom")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitOK, code)
+
+	code, out, _ := runCmd("bloom", "-json", "-fp", "0.01", "-o", filepath.Join(dir, "raw"), encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"hashes": 4`)
+	code, out, _ = runCmd("check", "-id", "11010920180401984X", bloomFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "可能有记录")
+	assert.NotContains(t, out, "空里流霜不觉飞")
+	code, out, _ = runCmd("check", "-json", "-info", "王五，男，1950", bloomFile)
+	assert.Equal(t, exitNoMatch, code)
+	assert.Contains(t, out, `"possible_match": false`)
+	code, _, _ = runCmd("check", "-id", "123", bloomFile)
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("bloom", "-fp", "2", "-o", bloomFile, encFile)
+	assert.Equal(t, exitError, code)
+}
+
+func TestCLIPSI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", rawFile)
+	assert.Equal(t, exitOK, code)
+	otherRaw := filepath.Join(dir, "other.txt")
+	otherFile := filepath.Join(dir, "other.yinao.txt")
+	err = ioutil.WriteFile(otherRaw, []byte(rawTxt[:strings.Index(rawTxt, "张若美")]), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ = runCmd("convert", otherRaw)
+	assert.Equal(t, exitOK, code)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	done := make(chan string)
+	go func() {
+		code, out, _ := runCmd("psi", "-timeout", "10s", "-listen", addr, otherFile)
+		assert.Equal(t, exitOK, code)
+		done <- out
+	}()
+	code, out, _ := runCmd("psi", "-json", "-timeout", "10s", "-connect", addr, encFile)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"base_info": 1`)
+	assert.Contains(t, out, `"id": 1`)
+	assert.Contains(t, out, "春江潮水连海平")
+	assert.NotContains(t, out, "空里流霜不觉飞")
+	out = <-done
+	assert.Contains(t, out, "双方共有1个基本信息和1个身份证号")
+
+	code, _, _ = runCmd("psi", encFile)
+	assert.Equal(t, exitError, code)
+}
+
+func TestCLIQueryServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw.yinao.txt")
+	err = ioutil.WriteFile(rawFile, []byte(rawTxt), 0644)
+	assert.Equal(t, nil, err)
+	code, _, _ := runCmd("convert", "-encrypt-desc", rawFile)
+	assert.Equal(t, exitOK, code)
+	yinaoDB, err := db.NewDBFromFiles([]string{encFile})
+	assert.Equal(t, nil, err)
+	defer yinaoDB.Close()
+	ts := httptest.NewServer(server.NewHandler(yinaoDB))
+	defer ts.Close()
+
+	// 描述在本地解密
+	code, out, _ := runCmd("query", "-server", ts.URL, "-id", "11010920180401984X")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "空里流霜不觉飞，汀上白沙看不见。")
+	assert.Contains(t, out, "11010920180401984X")
+
+	code, out, _ = runCmd("query", "-server", ts.URL, "-prefix", "6", "-json", "-info", "张若虚，男，2019")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, `"count": 1`)
+	assert.Contains(t, out, "张若虚，男，2019")
+	code, _, _ = runCmd("query", "-server", ts.URL, "-info", "张若虚，男，2020") //不查询相邻的年份
+	assert.Equal(t, exitNoMatch, code)
+	code, _, _ = runCmd("query", "-server", ts.URL, "-id", "11010920190401961X", "-name", "张若虚")
+	assert.Equal(t, exitError, code)
+
+	code, _, _ = runCmd("query", "-server", ts.URL, "-id", "11010920170401921X")
+	assert.Equal(t, exitNoMatch, code)
+	code, _, _ = runCmd("query", "-server", ts.URL, "-prefix", "4", "-id", "11010920180401984X")
+	assert.Equal(t, exitError, code)
+	code, _, _ = runCmd("query", "-server", ts.URL, "-id", "11010920180401984X", encFile)
+	assert.Equal(t, exitError, code)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 待扫描的目录及其置信参数调整值
+type dirSpec struct {
+	Dir   string
+	Delta float32
+}
+
+// 解析“目录=调整值”形式的参数，调整值可以省略，默认为0。
+// 与图形界面相同，调整值的单位是置信参数的百分之一，例如50会使置信参数增加0.5
+func parseDirSpec(arg string) (dirSpec, error) {
+	i := strings.LastIndex(arg, "=")
+	if i < 0 {
+		return dirSpec{Dir: arg}, nil
+	}
+	delta, err := strconv.ParseFloat(arg[i+1:], 32)
+	if err != nil {
+		return dirSpec{}, fmt.Errorf("%s 不是合法的数字！", arg[i+1:])
+	}
+	return dirSpec{Dir: arg[:i], Delta: float32(delta / 100.0)}, nil
+}
+
+// 扫描并且合并加密记录文件
+func runMerge(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("merge", "[-json] [-hash 哈希方案] [-secret 密钥文件] [-creator 创建者] [-keyring 密钥环文件] [-max-age 天数] -o 输出文件 目录[=置信参数调整值]...（调整值的单位是置信参数的百分之一）", stderr)
+	outFile := fs.String("o", "", "保存合并后的记录的输出文件，必须指定，以"+db.BinFileSuffix+"结尾时保存为二进制格式")
+	hf := addHashFlags(fs, true)
+	creator := fs.String("creator", "", "写入文件头部的创建者，可以为空")
+	keyringFile := fs.String("keyring", "", "密钥环文件，根据记录的贡献者调整置信参数或者丢弃记录")
+	df := addDecayFlags(fs, false)
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || len(*outFile) == 0 {
+		fs.Usage()
+		return exitError
+	}
+	specList := make([]dirSpec, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		spec, err := parseDirSpec(arg)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		if err := checkExist(spec.Dir, true); err != nil {
+			return fail(stderr, err)
+		}
+		specList = append(specList, spec)
+	}
+
+	hasher, err := hf.hasher()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	policy, err := df.policy()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	var errLog bytes.Buffer
+	records := db.NewRecordsWithScheme(hasher.Scheme())
+	records.Creator = *creator
+	records.Decay = policy
+	if len(*keyringFile) != 0 {
+		if records.Keyring, err = db.LoadKeyring(*keyringFile); err != nil {
+			return fail(stderr, err)
+		}
+	}
+	for _, spec := range specList {
+		records.AddEncRecordsInDir(spec.Dir, spec.Delta, &errLog)
+	}
+	if errLog.Len() != 0 {
+		stderr.Write(errLog.Bytes())
+		return fail(stderr, fmt.Errorf("合并时发现错误，合并后的记录不会被保存。"))
+	}
+
+	binary := strings.HasSuffix(*outFile, db.BinFileSuffix)
+	if !binary && !strings.HasSuffix(*outFile, db.EncFileSuffix) {
+		*outFile = *outFile + db.EncFileSuffix
+	}
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if binary {
+		err = records.WriteToBinary(out)
+	} else {
+		err = records.WriteToFile(out)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"output":    *outFile,
+			"records":   records.Len(),
+			"blocked":   records.Blocked(),
+			"retracted": records.Retracted(),
+			"expired":   records.Expired(),
+			"unsigned":  records.UnsignedTombstones(),
+		})
+	} else {
+		fmt.Fprintf(stdout, "合并完毕，共%d条记录，输出文件位于：%s\n", records.Len(), *outFile)
+		if records.Retracted() != 0 {
+			fmt.Fprintf(stdout, "另有%d条记录已被发布者撤回，已被丢弃\n", records.Retracted())
+		}
+		if records.Expired() != 0 {
+			fmt.Fprintf(stdout, "另有%d条记录超过了最大天数，已被丢弃\n", records.Expired())
+		}
+		if records.Blocked() != 0 {
+			fmt.Fprintf(stdout, "另有%d条记录的贡献者被屏蔽，已被丢弃\n", records.Blocked())
+		}
+		if records.UnsignedTombstones() != 0 {
+			fmt.Fprintf(stdout, "另有%d条撤回记录没有签名，已被忽略\n", records.UnsignedTombstones())
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 载入加密记录文件，将其中的记录以NDJSON格式导出，便于其他程序使用
+func runExport(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("export", "[-secret 密钥文件] [-no-index] [-o 输出文件] 加密记录文件...", stderr)
+	lf := addLoadFlags(fs, false)
+	outFile := fs.String("o", "", "输出文件，默认输出到标准输出")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+	yinaoDB, err := loadDB(fs.Args(), lf)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	defer yinaoDB.Close()
+	if len(*outFile) == 0 {
+		if err := yinaoDB.ExportNDJSON(stdout); err != nil {
+			return fail(stderr, err)
+		}
+		return exitOK
+	}
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	err = yinaoDB.ExportNDJSON(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	return exitOK
+}
+
+// 读取NDJSON格式的记录，检查之后合并为一个加密记录文件
+func runImport(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("import", "[-json] [-hash 哈希方案] [-secret 密钥文件] [-creator 创建者] -o 输出文件 NDJSON文件...", stderr)
+	outFile := fs.String("o", "", "保存导入的记录的输出文件，必须指定")
+	hf := addHashFlags(fs, true)
+	creator := fs.String("creator", "", "写入文件头部的创建者，可以为空")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || len(*outFile) == 0 {
+		fs.Usage()
+		return exitError
+	}
+	hasher, err := hf.hasher()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	records := db.NewRecordsWithScheme(hasher.Scheme())
+	records.Creator = *creator
+	var errLog bytes.Buffer
+	for _, fname := range fs.Args() {
+		if err := checkExist(fname, false); err != nil {
+			return fail(stderr, err)
+		}
+		f, err := os.Open(fname)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		var fileLog bytes.Buffer
+		err = records.AddNDJSON(f, 0, &fileLog)
+		f.Close()
+		if err != nil {
+			return fail(stderr, fmt.Errorf("读取文件%s时遇到错误：%s", fname, err.Error()))
+		}
+		if fileLog.Len() != 0 {
+			fmt.Fprintf(&errLog, "文件%s中有错误：\n%s", fname, fileLog.String())
+		}
+	}
+	if errLog.Len() != 0 {
+		stderr.Write(errLog.Bytes())
+		return fail(stderr, fmt.Errorf("导入时发现错误，导入的记录不会被保存。"))
+	}
+
+	if !strings.HasSuffix(*outFile, db.EncFileSuffix) {
+		*outFile = *outFile + db.EncFileSuffix
+	}
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	err = records.WriteToFile(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"output":  *outFile,
+			"records": records.Len(),
+		})
+	} else {
+		fmt.Fprintf(stdout, "导入完毕，共%d条记录，输出文件位于：%s\n", records.Len(), *outFile)
+	}
+	return exitOK
+}
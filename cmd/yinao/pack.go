@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 将文本格式的加密记录文件转为二进制格式，减小文件的大小
+func runPack(args []string, stdout, stderr io.Writer) int {
+	return runRepack("pack", db.EncFileSuffix, db.BinFileSuffix, db.WriteRecordsToBinary, args, stdout, stderr)
+}
+
+// 将二进制格式的加密记录文件转回文本格式
+func runUnpack(args []string, stdout, stderr io.Writer) int {
+	return runRepack("unpack", db.BinFileSuffix, db.EncFileSuffix, db.WriteRecordsToFileWithHeader, args, stdout, stderr)
+}
+
+// 读取后缀为from的加密记录文件，检查其中的记录之后，用write写入后缀为to的输出文件
+func runRepack(name, from, to string, write func(hdr *db.FileHeader, recList []*db.Record, file io.Writer) error, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet(name, "[-json] [-o 输出文件] 加密记录文件", stderr)
+	outFile := fs.String("o", "", "输出文件，默认与输入文件位于同一目录，以"+to+"结尾")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+	fname := fs.Arg(0)
+	if err := checkExist(fname, false); err != nil {
+		return fail(stderr, err)
+	}
+	if !strings.HasSuffix(fname, from) {
+		return fail(stderr, fmt.Errorf("%s 不是以%s结尾的加密记录文件", fname, from))
+	}
+	hdr, recList, err := db.ExtractRecordsFromEncFile(fname)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if len(*outFile) == 0 {
+		*outFile = strings.TrimSuffix(fname, from) + to
+	}
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	err = write(hdr, recList, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"input":   fname,
+			"output":  *outFile,
+			"records": len(recList),
+		})
+	} else {
+		fmt.Fprintf(stdout, "转换成功，共%d条记录，输出文件位于：%s\n", len(recList), *outFile)
+	}
+	return exitOK
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 与另一家医院进行隐私集合求交，双方只能得知共有的患者，而不会得知对方的其他记录
+func runPSI(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("psi", "[-json] [-secret 密钥文件] [-no-index] [-timeout 时长] (-listen 监听地址 | -connect 对方地址) 加密记录文件...", stderr)
+	lf := addLoadFlags(fs, false)
+	listen := fs.String("listen", "", "在这个地址上等待对方连接，例如127.0.0.1:8766")
+	connect := fs.String("connect", "", "连接对方的地址，对方还没有开始等待时会不断重试")
+	timeout := fs.Duration("timeout", 5*time.Minute, "等待对方和求交集的最长时间")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 || (len(*listen) == 0) == (len(*connect) == 0) {
+		fs.Usage()
+		return exitError
+	}
+	yinaoDB, err := loadDB(fs.Args(), lf)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	defer yinaoDB.Close()
+	set, err := yinaoDB.PSISet()
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	deadline := time.Now().Add(*timeout)
+	var conn net.Conn
+	if len(*listen) != 0 {
+		conn, err = acceptPSI(*listen, deadline, stderr)
+	} else {
+		conn, err = dialPSI(*connect, deadline)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+	res, err := db.RunPSI(conn, set)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	recList, err := yinaoDB.QueryPSISet(res)
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	if *asJSON {
+		jsonList := make([]*db.RecordJSON, len(recList))
+		for i, rec := range recList {
+			jsonList[i] = rec.ToJSON()
+		}
+		writeJSON(stdout, map[string]interface{}{
+			"base_info": len(res.BaseInfo),
+			"id":        len(res.ID),
+			"count":     len(recList),
+			"records":   jsonList,
+		})
+	} else {
+		fmt.Fprintf(stdout, "求交集完毕，双方共有%d个基本信息和%d个身份证号，本方在交集中的记录如下：\n\n", len(res.BaseInfo), len(res.ID))
+		writeResult(stdout, recList)
+	}
+	if len(recList) == 0 {
+		return exitNoMatch
+	}
+	return exitOK
+}
+
+// 在addr上等待对方连接，只接受一个连接
+func acceptPSI(addr string, deadline time.Time, stderr io.Writer) (net.Conn, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	ln.(*net.TCPListener).SetDeadline(deadline)
+	fmt.Fprintf(stderr, "正在等待对方连接：%s\n", ln.Addr().String())
+	return ln.Accept()
+}
+
+// 连接对方的地址addr，对方还没有开始等待时每秒重试一次，直到deadline
+func dialPSI(addr string, deadline time.Time) (net.Conn, error) {
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Until(deadline))
+		if err == nil || time.Now().Add(time.Second).After(deadline) {
+			return conn, err
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+	"github.com/YinaoBlacklist/YinaoBlacklist/server"
+)
+
+// 与载入加密记录文件有关的参数
+type loadFlags struct {
+	hf      *hashFlags
+	df      *decayFlags // 为nil时查询时不衰减置信参数
+	noIndex *bool
+}
+
+// 增加-secret和-no-index参数，withDecay为true时同时增加与衰减有关的参数
+func addLoadFlags(fs *flag.FlagSet, withDecay bool) *loadFlags {
+	lf := &loadFlags{hf: addHashFlags(fs, false)}
+	if withDecay {
+		lf.df = addDecayFlags(fs, true)
+	}
+	lf.noIndex = fs.Bool("no-index", false, "不使用、也不保存记录文件旁边的索引文件（以"+db.IndexFileSuffix+"结尾）")
+	return lf
+}
+
+// 检查并载入若干加密记录文件
+func loadDB(fileList []string, lf *loadFlags) (*db.DB, error) {
+	for _, fname := range fileList {
+		if err := checkExist(fname, false); err != nil {
+			return nil, err
+		}
+	}
+	secret, err := lf.hf.secret()
+	if err != nil {
+		return nil, err
+	}
+	var policy *db.DecayPolicy
+	if lf.df != nil {
+		if policy, err = lf.df.policy(); err != nil {
+			return nil, err
+		}
+	}
+	yinaoDB, err := db.NewDBFromFilesWithOptions(fileList, &db.LoadOptions{Secret: secret, UseIndex: !*lf.noIndex})
+	if err != nil {
+		return nil, err
+	}
+	yinaoDB.Decay = policy
+	return yinaoDB, nil
+}
+
+// 载入加密记录文件，检查其中是否有错误
+func runLoad(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("load", "[-json] [-secret 密钥文件] [-no-index] 加密记录文件...", stderr)
+	lf := addLoadFlags(fs, false)
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+	yinaoDB, err := loadDB(fs.Args(), lf)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	defer yinaoDB.Close()
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"files":   fs.Args(),
+			"records": yinaoDB.Len(),
+		})
+	} else {
+		fmt.Fprintf(stdout, "记录已成功载入，共%d个文件，%d条记录\n", fs.NArg(), yinaoDB.Len())
+	}
+	return exitOK
+}
+
+// 查询的方法，由数据库或者查询服务的客户端实现
+type searcher interface {
+	SearchBaseInfo(info string) ([]*db.RecordInFile, error)
+	SearchID(id string) ([]*db.RecordInFile, error)
+}
+
+// 使用加密记录文件，或者通过查询服务，按基本信息或者身份证号进行查询
+func runQuery(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("query", "[-json] [-secret 密钥文件] [-half-life 天数] [-max-age 天数] [-no-index] (-info 基本信息 | -id 身份证号 [-name 姓名]) (加密记录文件... | -server 地址 [-prefix 位数] [-scheme 哈希方案])", stderr)
+	lf := addLoadFlags(fs, true)
+	info := fs.String("info", "", "基本信息，格式为“姓名，性别，出生年份”，会同时查询出生年份加一和减一的记录（使用-server时除外）")
+	id := fs.String("id", "", "身份证号")
+	name := fs.String("name", "", "患者的姓名，与-id一起指定时，还会用身份证号中的性别和出生年份按基本信息进行查询，不能与-server一起使用")
+	serverURL := fs.String("server", "", "查询服务的地址，例如http://127.0.0.1:8765。指定时不需要加密记录文件，只向服务器发送哈希值的前缀，服务器无法得知查询的是谁")
+	prefixLen := fs.Int("prefix", server.DefaultPrefixLength, "与-server一起使用，发送的哈希值前缀的长度（十六进制位数），越短越难推测出查询的是谁，但返回的记录越多")
+	scheme := fs.String("scheme", "", "与-server一起使用，服务器上的文件使用了多种哈希方案时，指定使用其中的哪一种")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if (fs.NArg() == 0) == (len(*serverURL) == 0) || (len(*info) == 0) == (len(*id) == 0) || (len(*name) != 0 && len(*id) == 0) {
+		fs.Usage()
+		return exitError
+	}
+	var s searcher
+	var yinaoDB *db.DB
+	if len(*serverURL) != 0 {
+		if len(*name) != 0 {
+			return fail(stderr, fmt.Errorf("-name不能与-server一起使用：同时按身份证号和基本信息查询时，服务器可以把两次查询联系起来"))
+		}
+		secret, err := lf.hf.secret()
+		if err != nil {
+			return fail(stderr, err)
+		}
+		c := server.NewClient(*serverURL, secret)
+		c.PrefixLength = *prefixLen
+		c.Scheme = *scheme
+		s = c
+	} else {
+		var err error
+		if yinaoDB, err = loadDB(fs.Args(), lf); err != nil {
+			return fail(stderr, err)
+		}
+		defer yinaoDB.Close()
+		s = yinaoDB
+	}
+
+	var recList []*db.RecordInFile
+	var err error
+	if len(*info) != 0 {
+		recList, err = s.SearchBaseInfo(*info)
+	} else if len(*name) != 0 {
+		recList, err = yinaoDB.SearchIDWithName(*id, *name)
+	} else {
+		recList, err = s.SearchID(*id)
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if *asJSON {
+		jsonList := make([]*db.RecordJSON, len(recList))
+		for i, rec := range recList {
+			jsonList[i] = rec.ToJSON()
+		}
+		writeJSON(stdout, map[string]interface{}{
+			"count":   len(recList),
+			"records": jsonList,
+		})
+	} else {
+		writeResult(stdout, recList)
+	}
+	if len(recList) == 0 {
+		return exitNoMatch
+	}
+	return exitOK
+}
+
+// 以纯文本的形式输出查询结果，哈希值会被替换为查询时使用的明文
+func writeResult(stdout io.Writer, recList []*db.RecordInFile) {
+	if len(recList) == 0 {
+		fmt.Fprintln(stdout, "没有查询到记录")
+	}
+	for _, rec := range recList {
+		lines := rec.ToLines()
+		if len(rec.BaseInfo) != 0 {
+			lines[1] = rec.BaseInfo
+		}
+		if len(rec.ID) != 0 {
+			lines[2] = rec.ID
+		}
+		for _, line := range lines {
+			fmt.Fprintln(stdout, strings.ReplaceAll(line, "\\n", "\n"))
+		}
+		fmt.Fprintln(stdout)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 为自己发布过的加密记录生成撤回记录
+func runRetract(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("retract", "[-json] [-secret 密钥文件] -sign-key 私钥文件 [-info 基本信息] [-id 身份证号] [-reason 原因] -o 输出文件 加密记录文件", stderr)
+	outFile := fs.String("o", "", "保存撤回记录的输出文件，必须指定")
+	hf := addHashFlags(fs, false)
+	signKeyFile := fs.String("sign-key", "", "发布这些记录时所用的签名私钥文件，必须指定，只能撤回用它签名的记录。没有签名的记录无法被撤回")
+	info := fs.String("info", "", "只撤回基本信息为此值的记录，格式为“姓名，性别，出生年份”")
+	id := fs.String("id", "", "只撤回身份证号为此值的记录")
+	reason := fs.String("reason", "", "撤回的原因，默认为“"+db.DefaultRetractReason+"”")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 || len(*outFile) == 0 || len(*signKeyFile) == 0 {
+		fs.Usage()
+		return exitError
+	}
+	fname := fs.Arg(0)
+	if err := checkExist(fname, false); err != nil {
+		return fail(stderr, err)
+	}
+	if len(*info) != 0 {
+		if err := db.CheckBaseInfo(*info); err != nil {
+			return fail(stderr, err)
+		}
+	}
+	if len(*id) != 0 {
+		if err := db.CheckID(*id); err != nil {
+			return fail(stderr, err)
+		}
+	}
+	signingKey, err := readSigningKey(*signKeyFile)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	secret, err := hf.secret()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	hdr, recList, err := db.ExtractRecordsFromEncFile(fname)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	hasher, err := db.ParseHasher(hdr.Scheme, secret)
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	var signer [ed25519.PublicKeySize]byte
+	copy(signer[:], signingKey.Public().(ed25519.PublicKey))
+	tombs := make([]*db.Record, 0, len(recList))
+	for _, rec := range recList {
+		if rec.IsTombstone() || rec.Signer != signer {
+			continue
+		}
+		if len(*info) != 0 && rec.BaseInfoHash != hasher.Sum(hdr.NormalizeBaseInfo(*info)) {
+			continue
+		}
+		if len(*id) != 0 && rec.IDHash != hasher.Sum(hdr.NormalizeID(*id)) {
+			continue
+		}
+		tomb := db.NewTombstone(rec, *reason)
+		tomb.Sign(signingKey)
+		tombs = append(tombs, tomb)
+	}
+	if len(tombs) == 0 {
+		fmt.Fprintln(stderr, "没有找到可以撤回的记录")
+		return exitNoMatch
+	}
+
+	if !strings.HasSuffix(*outFile, db.EncFileSuffix) {
+		*outFile = *outFile + db.EncFileSuffix
+	}
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	err = db.WriteRecordsToFileWithHeader(&db.FileHeader{Scheme: hdr.Scheme, Normalization: hdr.Normalization}, tombs, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"input":   fname,
+			"output":  *outFile,
+			"records": len(tombs),
+		})
+	} else {
+		fmt.Fprintf(stdout, "已生成%d条撤回记录，输出文件位于：%s，请像转发其他记录文件一样转发它\n", len(tombs), *outFile)
+	}
+	return exitOK
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 与哈希方案有关的参数
+type hashFlags struct {
+	scheme     *string
+	secretFile *string
+}
+
+// 增加-secret参数，withScheme为true时同时增加-hash参数
+func addHashFlags(fs *flag.FlagSet, withScheme bool) *hashFlags {
+	hf := &hashFlags{}
+	if withScheme {
+		hf.scheme = fs.String("hash", "", "哈希方案："+db.SchemeSHA256+"、"+db.SchemeHMACSHA256+"或"+db.SchemeArgon2id+
+			"，默认在指定了-secret时使用"+db.SchemeHMACSHA256+"，否则使用"+db.SchemeSHA256+
+			"。\n"+db.SchemeArgon2id+"可以带上参数，例如"+db.SchemeArgon2id+"/t=1,m=65536,p=4")
+	}
+	hf.secretFile = fs.String("secret", "", "保存群组密钥的文件，用于带密钥的哈希方案")
+	return hf
+}
+
+// 读取群组密钥，没有指定密钥文件时返回nil
+func (hf *hashFlags) secret() ([]byte, error) {
+	if len(*hf.secretFile) == 0 {
+		return nil, nil
+	}
+	dat, err := ioutil.ReadFile(*hf.secretFile)
+	if err != nil {
+		return nil, err
+	}
+	dat = bytes.TrimSpace(dat)
+	if len(dat) == 0 {
+		return nil, fmt.Errorf("密钥文件%s是空的", *hf.secretFile)
+	}
+	return dat, nil
+}
+
+// 根据参数创建哈希方法
+func (hf *hashFlags) hasher() (db.Hasher, error) {
+	secret, err := hf.secret()
+	if err != nil {
+		return nil, err
+	}
+	scheme := *hf.scheme
+	if len(scheme) == 0 {
+		scheme = db.SchemeSHA256
+		if secret != nil {
+			scheme = db.SchemeHMACSHA256
+		}
+	}
+	switch scheme {
+	case db.SchemeSHA256:
+		if secret != nil {
+			return nil, fmt.Errorf("哈希方案%s不使用群组密钥", scheme)
+		}
+		return db.SHA256Hasher, nil
+	case db.SchemeHMACSHA256:
+		if secret == nil {
+			return nil, fmt.Errorf("哈希方案%s需要用-secret指定群组密钥", scheme)
+		}
+		return db.NewHMACHasher(secret), nil
+	}
+	if scheme == db.SchemeArgon2id || strings.HasPrefix(scheme, db.SchemeArgon2id+"/") {
+		if secret != nil {
+			return nil, fmt.Errorf("哈希方案%s不使用群组密钥", scheme)
+		}
+		if scheme == db.SchemeArgon2id {
+			return db.NewArgon2Hasher(db.DefaultArgon2Time, db.DefaultArgon2Memory, db.DefaultArgon2Threads)
+		}
+		return db.ParseHasher(scheme, nil)
+	}
+	return nil, fmt.Errorf("不支持的哈希方案：%s", scheme)
+}
+
+// 随机生成一个群组密钥
+func runGenSecret(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("gensecret", "-o 密钥文件", stderr)
+	outFile := fs.String("o", "", "保存群组密钥的文件，必须指定")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 0 || len(*outFile) == 0 {
+		fs.Usage()
+		return exitError
+	}
+	if _, err := os.Stat(*outFile); err == nil {
+		return fail(stderr, fmt.Errorf("文件%s已经存在，不会被覆盖", *outFile))
+	}
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return fail(stderr, err)
+	}
+	secret := base64.StdEncoding.EncodeToString(buf[:]) + "\n"
+	if err := ioutil.WriteFile(*outFile, []byte(secret), 0600); err != nil {
+		return fail(stderr, err)
+	}
+	fmt.Fprintf(stdout, "群组密钥已保存到：%s，请只在群组内部分享此文件\n", *outFile)
+	return exitOK
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/server"
+)
+
+// 载入加密记录文件，在本地地址上提供HTTP/JSON查询服务
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("serve", "[-addr 监听地址] [-secret 密钥文件] [-half-life 天数] [-max-age 天数] [-no-index] [-watch 间隔] 加密记录文件...", stderr)
+	lf := addLoadFlags(fs, true)
+	addr := fs.String("addr", "127.0.0.1:8765", "查询服务的监听地址")
+	watch := fs.Duration("watch", 0, "每隔多久检查一次记录文件，有变化时重新载入，例如5s，为0时不检查")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+	yinaoDB, err := loadDB(fs.Args(), lf)
+	if err != nil {
+		return fail(stderr, err)
+	}
+	defer yinaoDB.Close()
+	if *watch > 0 {
+		yinaoDB.Watch(*watch, func(reloaded []string, err error) {
+			for _, fname := range reloaded {
+				fmt.Fprintf(stderr, "已重新载入文件：%s\n", fname)
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "重新载入时遇到错误：%s\n", err.Error())
+			}
+		})
+	}
+
+	srv := &http.Server{
+		Addr:         *addr,
+		Handler:      server.NewHandler(yinaoDB),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	fmt.Fprintf(stdout, "已载入%d条记录，查询服务监听于：http://%s\n", yinaoDB.Len(), *addr)
+	if err := srv.ListenAndServe(); err != nil {
+		return fail(stderr, err)
+	}
+	return exitOK
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 读取贡献者的签名私钥，没有指定私钥文件时返回nil
+func readSigningKey(fname string) (ed25519.PrivateKey, error) {
+	if len(fname) == 0 {
+		return nil, nil
+	}
+	dat, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := db.ParsePrivateKey(string(dat))
+	if err != nil {
+		return nil, fmt.Errorf("私钥文件%s有误：%s", fname, err.Error())
+	}
+	return priv, nil
+}
+
+// 随机生成一个贡献者的签名私钥，并显示对应的公钥
+func runKeyGen(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("keygen", "[-json] -o 私钥文件", stderr)
+	outFile := fs.String("o", "", "保存签名私钥的文件，必须指定")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 0 || len(*outFile) == 0 {
+		fs.Usage()
+		return exitError
+	}
+	if _, err := os.Stat(*outFile); err == nil {
+		return fail(stderr, fmt.Errorf("文件%s已经存在，不会被覆盖", *outFile))
+	}
+	priv, err := db.GenerateSigningKey()
+	if err != nil {
+		return fail(stderr, err)
+	}
+	if err := ioutil.WriteFile(*outFile, []byte(db.FormatPrivateKey(priv)+"\n"), 0600); err != nil {
+		return fail(stderr, err)
+	}
+	pub := db.FormatPublicKey(priv.Public().(ed25519.PublicKey))
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{
+			"private_key_file": *outFile,
+			"public_key":       pub,
+		})
+	} else {
+		fmt.Fprintf(stdout, "签名私钥已保存到：%s，请妥善保管，不要分享给任何人\n您的公钥是：%s\n", *outFile, pub)
+	}
+	return exitOK
+}
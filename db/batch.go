@@ -0,0 +1,237 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// 批量查询时，名单文件中的一行
+type BatchRow struct {
+	Line     int    // 在名单文件中的行号，从1开始
+	BaseInfo string // 基本信息，格式为“姓名，性别，出生年份”，没有时为空
+	ID       string // 身份证号，没有时为空
+}
+
+// 批量查询时，名单文件中一行的查询结果
+type BatchResult struct {
+	BatchRow
+	Errors  []string        // 基本信息或者身份证号的输入错误，有错误的那一项不会被查询
+	Matches []*RecordInFile // 按基本信息（包括相邻年份）和身份证号查询到的记录
+}
+
+// 名单文件表头中各列的名称，出生日期只取前4位作为出生年份
+var batchColumns = map[string]string{
+	"基本信息":  "info",
+	"姓名":    "name",
+	"性别":    "gender",
+	"出生年份":  "year",
+	"出生年":   "year",
+	"出生日期":  "year",
+	"身份证号":  "id",
+	"身份证号码": "id",
+	"证件号码":  "id",
+}
+
+// 读取名单文件，见ParseBatchFile。文件的编码会被自动识别，从Excel中另存的GBK或者UTF-16文件也可以读取
+func ReadBatchFile(fname string) ([]BatchRow, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	text, _, err := DecodeText(data, EncodingAuto)
+	if err != nil {
+		return nil, fmt.Errorf("读取名单文件%s时遇到错误：%s", fname, err.Error())
+	}
+	return ParseBatchFile(bytes.NewReader(text))
+}
+
+// 解析从HIS等系统导出的名单文件，每行一个患者，各列用英文逗号或者制表符隔开（以第一行为准）。
+// 如果第一行是表头（含有“姓名”、“性别”、“出生年份”、“身份证号”、“基本信息”等列名），按列名取值；
+// 否则每个单元格中含有中文逗号的是基本信息，其他的是身份证号。空行会被跳过，一个单元格中不能有换行
+func ParseBatchFile(r io.Reader) ([]BatchRow, error) {
+	var rows []BatchRow
+	var columns map[int]string
+	comma := ','
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff") //从Excel中导出的文件可能带有BOM
+			if strings.Contains(text, "\t") {
+				comma = '\t'
+			}
+		}
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		reader := csv.NewReader(strings.NewReader(text))
+		reader.Comma = comma
+		reader.LazyQuotes = true
+		cells, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("名单文件第%d行格式错误：%s", line, err.Error())
+		}
+		for i, cell := range cells {
+			cells[i] = strings.TrimSpace(cell)
+		}
+		if line == 1 {
+			if columns = parseBatchHeader(cells); columns != nil {
+				continue
+			}
+		}
+		row := BatchRow{Line: line}
+		if columns != nil {
+			row.fillByColumns(cells, columns)
+		} else {
+			for _, cell := range cells {
+				if strings.Contains(cell, "，") {
+					row.BaseInfo = cell
+				} else if len(cell) != 0 {
+					row.ID = strings.ToUpper(cell)
+				}
+			}
+		}
+		if len(row.BaseInfo) == 0 && len(row.ID) == 0 && len(strings.Join(cells, "")) == 0 {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// 如果cells是表头，返回列号到列名的映射，否则返回nil
+func parseBatchHeader(cells []string) map[int]string {
+	var columns map[int]string
+	for i, cell := range cells {
+		if col, ok := batchColumns[cell]; ok {
+			if columns == nil {
+				columns = make(map[int]string)
+			}
+			columns[i] = col
+		}
+	}
+	return columns
+}
+
+// 按照表头中的列名，用一行中的各个单元格填充基本信息和身份证号
+func (row *BatchRow) fillByColumns(cells []string, columns map[int]string) {
+	var name, gender, year string
+	for i, cell := range cells {
+		switch columns[i] {
+		case "info":
+			row.BaseInfo = cell
+		case "name":
+			name = cell
+		case "gender":
+			gender = cell
+		case "year":
+			year = yearOf(cell)
+		case "id":
+			row.ID = strings.ToUpper(cell)
+		}
+	}
+	if len(row.BaseInfo) == 0 && (len(name) != 0 || len(gender) != 0 || len(year) != 0) {
+		row.BaseInfo = strings.Join([]string{name, gender, year}, "，")
+	}
+	if len(row.BaseInfo) != 0 && len(row.ID) != 0 { //名单中没有性别或者出生年份时，用身份证号补全
+		row.BaseInfo = FillBaseInfoFromID(row.BaseInfo, row.ID)
+	}
+}
+
+// 表格中的出生年份一列也可能是出生日期，这时只取前4位作为出生年份
+func yearOf(cell string) string {
+	if len(cell) > 4 {
+		if _, err := strconv.Atoi(cell[:4]); err == nil {
+			return cell[:4]
+		}
+	}
+	return cell
+}
+
+// 对名单中的每一行，按基本信息（包括相邻年份）和身份证号进行查询，同时被两项查询到的记录只返回一次。
+// 输入有误的项目会被记录在结果的Errors中，不影响其他项目和其他行的查询
+func (db *DB) SearchBatch(rows []BatchRow) ([]*BatchResult, error) {
+	results := make([]*BatchResult, 0, len(rows))
+	for _, row := range rows {
+		res := &BatchResult{BatchRow: row}
+		if len(row.BaseInfo) == 0 && len(row.ID) == 0 {
+			res.Errors = append(res.Errors, "没有基本信息，也没有身份证号")
+		}
+		if len(row.BaseInfo) != 0 {
+			if err := CheckBaseInfo(row.BaseInfo); err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			} else {
+				recList, err := db.SearchBaseInfo(row.BaseInfo)
+				if err != nil {
+					return nil, err
+				}
+				res.Matches = append(res.Matches, recList...)
+			}
+		}
+		if len(row.ID) != 0 {
+			if err := CheckID(row.ID); err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			} else {
+				recList, err := db.SearchID(row.ID)
+				if err != nil {
+					return nil, err
+				}
+				res.Matches = appendUnique(res.Matches, recList) //同时被两项查询到的记录只报告一次
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// 查询结果是通过哪一项匹配到的
+func (res *BatchResult) matchedBy(rec *RecordInFile) string {
+	byInfo := ""
+	switch {
+	case len(rec.BaseInfo) == 0:
+	case rec.BaseInfo == res.BaseInfo || rec.BaseInfo == NormalizeBaseInfo(res.BaseInfo):
+		byInfo = "基本信息"
+	default:
+		byInfo = "基本信息（出生年份相差一年）"
+	}
+	switch {
+	case len(rec.ID) == 0:
+		return byInfo
+	case len(byInfo) == 0:
+		return "身份证号"
+	default:
+		return "身份证号和" + byInfo
+	}
+}
+
+// 将批量查询的结果写成CSV格式的报告，每条查询到的记录占一行，没有查询到记录或者输入有误的行也各占一行
+func WriteBatchReport(w io.Writer, results []*BatchResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"行号", "基本信息", "身份证号", "结果", "匹配项", "置信参数", "来源文件", "描述", "输入错误"})
+	for _, res := range results {
+		errs := strings.Join(res.Errors, "；")
+		prefix := []string{strconv.Itoa(res.Line), res.BaseInfo, res.ID}
+		if len(res.Matches) == 0 {
+			status := "没有查询到记录"
+			if len(res.Errors) != 0 {
+				status = "输入有误"
+			}
+			cw.Write(append(prefix, status, "", "", "", "", errs))
+			continue
+		}
+		for _, rec := range res.Matches {
+			cw.Write(append(prefix, "查询到记录", res.matchedBy(rec),
+				strconv.FormatFloat(float64(rec.Confidence), 'f', -1, 32), rec.FileName,
+				strings.ReplaceAll(rec.Description, "\\n", " "), errs))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatchFile(t *testing.T) {
+	rows, err := ParseBatchFile(strings.NewReader("\ufeff姓名\t性别\t出生日期\t身份证号\n" +
+		"张若虚\t男\t2020-03-01\t\n\n" +
+		"张若美\t女\t2018\t11010920180401984x\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []BatchRow{
+		{Line: 2, BaseInfo: "张若虚，男，2020"},
+		{Line: 4, BaseInfo: "张若美，女，2018", ID: "11010920180401984X"},
+	}, rows)
+
+	// 名单中只有姓名和身份证号时，用身份证号补全基本信息
+	rows, err = ParseBatchFile(strings.NewReader("姓名,身份证号\n张若美,11010920180401984X\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []BatchRow{{Line: 2, BaseInfo: "张若美，女，2018", ID: "11010920180401984X"}}, rows)
+
+	// 没有表头时，按单元格的内容区分基本信息和身份证号
+	rows, err = ParseBatchFile(strings.NewReader("张若虚，男，2019,11010920190401961X\n11010920180401984X\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []BatchRow{
+		{Line: 1, BaseInfo: "张若虚，男，2019", ID: "11010920190401961X"},
+		{Line: 2, ID: "11010920180401984X"},
+	}, rows)
+}
+
+func TestSearchBatch(t *testing.T) {
+	convertAndWriteToFile(File1, "./A.yinao.txt")
+	defer os.RemoveAll("./A.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	assert.Equal(t, nil, err)
+	defer db.Close()
+
+	results, err := db.SearchBatch([]BatchRow{
+		{Line: 2, BaseInfo: "张若虚，男，2020"},
+		{Line: 3, BaseInfo: "张若美，女，2018", ID: "11010920180401984X"},
+		{Line: 4, BaseInfo: "王五，未知，1990", ID: "123"},
+		{Line: 5, BaseInfo: "李四，男，1980"},
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, 1, len(results[0].Matches))
+	assert.Equal(t, 1, len(results[1].Matches)) //同时按基本信息和身份证号查询到的记录只出现一次
+	assert.Equal(t, 0, len(results[2].Matches))
+	assert.Equal(t, 2, len(results[2].Errors))
+	assert.Equal(t, 0, len(results[3].Matches))
+	assert.Equal(t, 0, len(results[3].Errors))
+
+	var b bytes.Buffer
+	err = WriteBatchReport(&b, results)
+	assert.Equal(t, nil, err)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 5, len(lines))
+	assert.Equal(t, "2,张若虚，男，2020,,查询到记录,基本信息（出生年份相差一年）,19,./A.yinao.txt,春江潮水连海平，海上明月共潮生。 滟滟随波千万里，何处春江无月明？,", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "3,张若美，女，2018,11010920180401984X,查询到记录,身份证号和基本信息,98,"))
+	assert.True(t, strings.HasPrefix(lines[3], "4,王五，未知，1990,123,输入有误,"))
+	assert.Equal(t, "5,李四，男，1980,,没有查询到记录,,,,,", lines[4])
+}
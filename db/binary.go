@@ -0,0 +1,520 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	BinFileSuffix = ".yinao.bin" // 二进制格式的加密记录文件的后缀
+	binMagic      = "YINAOBIN"   // 二进制格式的文件开头的8个字节
+	binVersion    = 1            // 二进制容器格式的版本，与文件头部中的格式版本无关
+
+	// 描述表解压之后最多是文件大小的多少倍（另加1MB）。描述已经去重，正常的文件远达不到这个倍数，
+	// 限制它是为了防止很小的恶意文件在载入和合并时解压出几个GB的数据
+	maxDescExpansion = 32
+)
+
+// 二进制记录中flags的各位，表示记录带有哪些扩展字段
+const (
+	binFlagDate      = 1 << iota // 医闹事件的日期
+	binFlagPublished             // 发布日期
+	binFlagRetract               // 被撤回记录的指纹
+	binFlagSig                   // 签名者的公钥和签名
+	binFlagAll       = binFlagDate | binFlagPublished | binFlagRetract | binFlagSig
+)
+
+// 二进制格式的加密记录文件，用于减小转发时的文件大小。所有整数都是大端序，变长整数使用uvarint编码：
+//  1. 8字节的binMagic和2字节的容器格式版本
+//  2. 文件头部：变长整数表示的长度，以及与文本格式相同的头部（各行用\n隔开）
+//  3. 描述表：变长整数表示的长度，以及用deflate压缩的各个描述，每个描述是变长整数表示的长度和UTF-8文本，相同的描述只保存一次
+//  4. 记录：变长整数表示的条数和总长度，以及各条记录。每条记录依次是32字节的BaseInfoHash、32字节的IDHash、
+//     4字节的置信参数（float32）、4字节的Crc32、变长整数表示的描述序号、1字节的flags，以及flags所指示的
+//     事件日期、发布日期（都是从1970-01-01起的天数，有符号的变长整数）、32字节的撤回指纹、32字节的公钥和64字节的签名
+//  5. 索引：BaseInfoHash和IDHash的索引，各是变长整数表示的条数，以及每条的8字节键（哈希值的低8个字节）和
+//     变长整数表示的记录在文件中的位置；然后是撤回记录的条数和它们的位置
+//  6. 以上所有内容的sha256
+type binWriter struct {
+	bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *binWriter) uvarint(n uint64) {
+	w.Write(w.tmp[:binary.PutUvarint(w.tmp[:], n)])
+}
+
+func (w *binWriter) varint(n int64) {
+	w.Write(w.tmp[:binary.PutVarint(w.tmp[:], n)])
+}
+
+func (w *binWriter) uint32(n uint32) {
+	binary.BigEndian.PutUint32(w.tmp[:4], n)
+	w.Write(w.tmp[:4])
+}
+
+// 写入变长整数表示的长度和内容
+func (w *binWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.Write(b)
+}
+
+// 日期到1970-01-01的天数
+func daysSinceEpoch(t time.Time) int64 {
+	return int64(math.Floor(float64(t.Unix()) / float64(day/time.Second)))
+}
+
+// 将一条记录写入w，descIndex是它的描述在描述表中的序号
+func (w *binWriter) record(rec *Record, descIndex int) {
+	w.Write(rec.BaseInfoHash[:])
+	w.Write(rec.IDHash[:])
+	w.uint32(math.Float32bits(rec.Confidence))
+	w.uint32(rec.Crc32)
+	w.uvarint(uint64(descIndex))
+	flags := byte(0)
+	if !rec.IncidentDate.IsZero() {
+		flags |= binFlagDate
+	}
+	if !rec.PublishDate.IsZero() {
+		flags |= binFlagPublished
+	}
+	if rec.IsTombstone() {
+		flags |= binFlagRetract
+	}
+	if rec.IsSigned() {
+		flags |= binFlagSig
+	}
+	w.WriteByte(flags)
+	if flags&binFlagDate != 0 {
+		w.varint(daysSinceEpoch(rec.IncidentDate))
+	}
+	if flags&binFlagPublished != 0 {
+		w.varint(daysSinceEpoch(rec.PublishDate))
+	}
+	if flags&binFlagRetract != 0 {
+		w.Write(rec.Retract[:])
+	}
+	if flags&binFlagSig != 0 {
+		w.Write(rec.Signer[:])
+		w.Write(rec.Signature[:])
+	}
+}
+
+// 将文件头部和各条记录以二进制格式写入file，hdr为nil时与WriteRecordsToFileWithHeader一样处理
+func WriteRecordsToBinary(hdr *FileHeader, recList []*Record, file io.Writer) error {
+	if hdr == nil {
+		hdr = &FileHeader{Scheme: SchemeSHA256, Normalization: NormalizationVersion}
+	}
+	// 描述表
+	descIndex := make(map[string]int)
+	var descs bytes.Buffer
+	zw, err := flate.NewWriter(&descs, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	var dw binWriter
+	recDescs := make([]int, len(recList))
+	for i, rec := range recList {
+		n, ok := descIndex[rec.Description]
+		if !ok {
+			n = len(descIndex)
+			descIndex[rec.Description] = n
+			dw.bytes([]byte(rec.Description))
+		}
+		recDescs[i] = n
+	}
+	if _, err := zw.Write(dw.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	var w binWriter
+	w.WriteString(binMagic)
+	binary.BigEndian.PutUint16(w.tmp[:2], binVersion)
+	w.Write(w.tmp[:2])
+	w.bytes([]byte(strings.Join(hdr.ToLines(), "\n")))
+	w.bytes(descs.Bytes())
+	// 记录，先写到另一个缓冲区中，以便计算它们的总长度和各自的位置
+	var rw binWriter
+	offsets := make([]int, len(recList))
+	for i, rec := range recList {
+		offsets[i] = rw.Len()
+		rw.record(rec, recDescs[i])
+	}
+	w.uvarint(uint64(len(recList)))
+	w.uvarint(uint64(rw.Len()))
+	start := w.Len()
+	w.Write(rw.Bytes())
+	// 索引
+	var baseInfo, tombs []int
+	for i, rec := range recList {
+		if rec.IsTombstone() {
+			tombs = append(tombs, i)
+		} else {
+			baseInfo = append(baseInfo, i)
+		}
+	}
+	for _, key := range []func(rec *Record) []byte{
+		func(rec *Record) []byte { return rec.BaseInfoHash[:8] },
+		func(rec *Record) []byte { return rec.IDHash[:8] }, //身份证号为NA的记录也在其中，载入时才去掉它们
+	} {
+		w.uvarint(uint64(len(baseInfo)))
+		for _, i := range baseInfo {
+			w.Write(key(recList[i]))
+			w.uvarint(uint64(start + offsets[i]))
+		}
+	}
+	w.uvarint(uint64(len(tombs)))
+	for _, i := range tombs {
+		w.uvarint(uint64(start + offsets[i]))
+	}
+	sum := sha256.Sum256(w.Bytes())
+	w.Write(sum[:])
+	_, err = file.Write(w.Bytes())
+	return err
+}
+
+// 将各条记录以二进制格式写入文件，与WriteToFile写入的记录和顺序都相同
+func (recs *Records) WriteToBinary(file io.Writer) error {
+	hdr := &FileHeader{Scheme: recs.scheme, Creator: recs.Creator, Normalization: recs.normalization}
+	return WriteRecordsToBinary(hdr, recs.sorted(), file)
+}
+
+// 读取二进制格式时使用的Reader
+type binReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// 读取变长整数表示的长度和内容，长度不能超过max
+func readBinBytes(r binReader, max int) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(max) {
+		return nil, fmt.Errorf("长度%d超出了文件的范围", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// 从r中读取一条记录，descs是文件的描述表。返回错误时，r中的位置是不确定的
+func readBinRecord(r binReader, descs []string) (*Record, error) {
+	rec := &Record{}
+	var buf [8]byte
+	if _, err := io.ReadFull(r, rec.BaseInfoHash[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, rec.IDHash[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	rec.Confidence = math.Float32frombits(binary.BigEndian.Uint32(buf[:4]))
+	rec.Crc32 = binary.BigEndian.Uint32(buf[4:])
+	if rec.Confidence < 0 || rec.Confidence > 100 || math.IsNaN(float64(rec.Confidence)) {
+		return nil, fmt.Errorf("置信参数%f超出了范围", rec.Confidence)
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n >= uint64(len(descs)) {
+		return nil, fmt.Errorf("描述的序号%d超出了描述表的范围", n)
+	}
+	rec.Description = descs[n]
+	flags, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if flags&^binFlagAll != 0 {
+		return nil, fmt.Errorf("未知的扩展字段：%x", flags)
+	}
+	if flags&binFlagDate != 0 {
+		days, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		rec.IncidentDate = time.Unix(days*int64(day/time.Second), 0).UTC()
+	}
+	if flags&binFlagPublished != 0 {
+		days, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		rec.PublishDate = time.Unix(days*int64(day/time.Second), 0).UTC()
+	}
+	if flags&binFlagRetract != 0 {
+		if _, err := io.ReadFull(r, rec.Retract[:]); err != nil {
+			return nil, err
+		}
+	}
+	if flags&binFlagSig != 0 {
+		if _, err := io.ReadFull(r, rec.Signer[:]); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, rec.Signature[:]); err != nil {
+			return nil, err
+		}
+	}
+	return rec, nil
+}
+
+// 与文本格式的记录一样，检查记录的校验码和签名
+func verifyBinRecord(rec *Record) error {
+	if !rec.VerifyChecksum() {
+		return fmt.Errorf("校验码错误")
+	}
+	if rec.IsSigned() && !rec.VerifySignature() {
+		return fmt.Errorf("签名错误，记录可能被篡改过")
+	}
+	return nil
+}
+
+// 解析后的二进制格式的文件
+type binFile struct {
+	header   *FileHeader
+	descs    []string
+	count    int          // 记录的条数
+	start    int          // 第一条记录在文件中的位置
+	end      int          // 最后一条记录之后的位置
+	baseInfo []indexEntry // 文件内部的BaseInfoHash索引
+	id       []indexEntry // 文件内部的IDHash索引，包括身份证号为NA的记录
+	tombs    []int64      // 撤回记录在文件中的位置
+}
+
+// 检查并解析二进制格式的文件的全部内容data
+func parseBinFile(data []byte) (*binFile, error) {
+	if len(data) < len(binMagic)+2+sha256.Size || string(data[:len(binMagic)]) != binMagic {
+		return nil, fmt.Errorf("不是二进制格式的加密记录文件")
+	}
+	body := data[:len(data)-sha256.Size]
+	if sum := sha256.Sum256(body); !bytes.Equal(sum[:], data[len(body):]) {
+		return nil, fmt.Errorf("文件的校验和错误，文件可能已经损坏")
+	}
+	if v := binary.BigEndian.Uint16(data[len(binMagic):]); v != binVersion {
+		return nil, fmt.Errorf("二进制格式的版本%d与本程序所使用的版本%d不同，请升级本程序", v, binVersion)
+	}
+	r := bytes.NewReader(body[len(binMagic)+2:])
+	pos := func() int { return len(body) - r.Len() }
+	bf := &binFile{}
+	hdrText, err := readBinBytes(r, r.Len())
+	if err != nil {
+		return nil, fmt.Errorf("文件头部的格式错误：%s", err.Error())
+	}
+	lines := strings.Split(string(hdrText), "\n")
+	if !isHeader(lines) {
+		return nil, fmt.Errorf("文件头部的格式错误")
+	}
+	if bf.header, err = parseHeader(lines); err != nil {
+		return nil, err
+	}
+	compressed, err := readBinBytes(r, r.Len())
+	if err != nil {
+		return nil, fmt.Errorf("描述表的格式错误：%s", err.Error())
+	}
+	limit := int64(len(data))*maxDescExpansion + 1<<20
+	descData, err := ioutil.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("描述表的格式错误：%s", err.Error())
+	}
+	if int64(len(descData)) > limit {
+		return nil, fmt.Errorf("描述表解压之后超过了%d字节，文件可能是恶意构造的", limit)
+	}
+	for dr := bytes.NewReader(descData); dr.Len() != 0; {
+		desc, err := readBinBytes(dr, dr.Len())
+		if err != nil {
+			return nil, fmt.Errorf("描述表的格式错误：%s", err.Error())
+		}
+		bf.descs = append(bf.descs, string(desc))
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("记录的格式错误：%s", err.Error())
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil || size > uint64(r.Len()) {
+		return nil, fmt.Errorf("记录的格式错误")
+	}
+	bf.count, bf.start = int(count), pos()
+	bf.end = bf.start + int(size)
+	r.Seek(int64(size), io.SeekCurrent)
+
+	readOffset := func() (int64, error) {
+		off, err := binary.ReadUvarint(r)
+		if err != nil || off < uint64(bf.start) || off >= uint64(bf.end) {
+			return 0, fmt.Errorf("索引的格式错误")
+		}
+		return int64(off), nil
+	}
+	for _, index := range []*[]indexEntry{&bf.baseInfo, &bf.id} {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > count {
+			return nil, fmt.Errorf("索引的格式错误")
+		}
+		*index = make([]indexEntry, n)
+		for i := range *index {
+			entry := &(*index)[i]
+			if _, err := io.ReadFull(r, entry.Key[:]); err != nil {
+				return nil, fmt.Errorf("索引的格式错误")
+			}
+			if entry.Offset, err = readOffset(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > count {
+		return nil, fmt.Errorf("索引的格式错误")
+	}
+	for i := uint64(0); i < n; i++ {
+		off, err := readOffset()
+		if err != nil {
+			return nil, err
+		}
+		bf.tombs = append(bf.tombs, off)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("文件的末尾有多余的内容")
+	}
+	return bf, nil
+}
+
+// 二进制格式的文件中，位于off的一条记录
+func (bf *binFile) recordAt(data []byte, off int64) (*Record, error) {
+	rec, err := readBinRecord(bytes.NewReader(data[off:bf.end]), bf.descs)
+	if err == nil {
+		err = verifyBinRecord(rec)
+	}
+	return rec, err
+}
+
+// 依次读取二进制格式的文件中的全部记录并检查校验码和签名，交给fn处理，off是记录在文件中的位置。
+// 有错误的记录会被写入errLog并被跳过；记录的格式错误，或者最后一条记录之后还有多余的内容时返回错误
+func (bf *binFile) records(data []byte, fname string, errLog io.Writer, fn func(rec *Record, off int64) error) error {
+	rr := bytes.NewReader(data[bf.start:bf.end])
+	for i := 0; i < bf.count; i++ {
+		off := int64(bf.end - rr.Len())
+		rec, err := readBinRecord(rr, bf.descs)
+		if err != nil { //记录的格式错误时，无法找到下一条记录的位置
+			return fmt.Errorf("读取文件%s时，位于%d的记录有错误：%s", fname, off, err.Error())
+		}
+		if err := verifyBinRecord(rec); err != nil {
+			fmt.Fprintf(errLog, "读取文件%s时，位于%d的记录有错误：%s\n", fname, off, err.Error())
+			continue
+		}
+		if err := fn(rec, off); err != nil {
+			return err
+		}
+	}
+	if rr.Len() != 0 {
+		return fmt.Errorf("读取文件%s时，遇到错误：最后一条记录之后有%d字节多余的内容", fname, rr.Len())
+	}
+	return nil
+}
+
+// 读取二进制格式的文件f，用文件内部的索引得到它的fileIndex。
+// 与扫描文本格式的文件时一样，载入时会检查每一条记录，有错误的文件无法载入，不会等到查询时才发现
+func loadBinIndex(fname string, f *os.File, opts *LoadOptions) (*fileIndex, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.NewSectionReader(f, 0, fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	bf, err := parseBinFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
+	}
+	var b bytes.Buffer
+	if err := bf.records(data, fname, &b, func(rec *Record, off int64) error { return nil }); err != nil {
+		return nil, err
+	}
+	if b.Len() != 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSuffix(b.String(), "\n"))
+	}
+	idx := &fileIndex{
+		Version:      indexVersion,
+		Size:         fi.Size(),
+		ModTime:      fi.ModTime().UnixNano(),
+		Header:       *bf.header,
+		BaseInfo:     bf.baseInfo,
+		Binary:       true,
+		Descriptions: bf.descs,
+	}
+	if bf.count != 0 { //与扫描文本格式的文件时一样，去掉身份证号为NA的记录
+		hasher, err := ParseHasher(bf.header.Scheme, opts.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
+		}
+		shaNA := hasher.Sum("NA")
+		for _, entry := range bf.id {
+			if !bytes.Equal(entry.Key[:], shaNA[:8]) {
+				idx.ID = append(idx.ID, entry)
+			}
+		}
+	}
+	for _, off := range bf.tombs {
+		rec, err := bf.recordAt(data, off)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
+		}
+		idx.Tombstones = append(idx.Tombstones, *rec)
+	}
+	if fi, err = f.Stat(); err != nil {
+		return nil, err
+	}
+	if idx.stale(fi) {
+		return nil, fmt.Errorf("读取文件%s时，文件被修改了", fname)
+	}
+	return idx, nil
+}
+
+// 读取二进制格式的文件中的全部记录，交给fn处理，off是记录在文件中的位置。
+// 与文本格式的文件一样，有错误的记录会被写入errLog并被跳过
+func extractBinRecords(r io.Reader, fname string, errLog io.Writer, fn func(hdr *FileHeader, rec *Record, off int64) error) (*FileHeader, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	bf, err := parseBinFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
+	}
+	err = bf.records(data, fname, errLog, func(rec *Record, off int64) error {
+		return fn(bf.header, rec, off)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bf.header, nil
+}
+
+// 从二进制格式的文件中读取位于pos的记录
+func readBinRecordAt(file *os.File, idx *fileIndex, pos Position) (*RecordInFile, error) {
+	r := bufio.NewReader(io.NewSectionReader(file, pos.Offset, math.MaxInt64-pos.Offset))
+	rec, err := readBinRecord(r, idx.Descriptions)
+	if err == nil {
+		err = verifyBinRecord(rec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取文件%s时，遇到错误：%s", pos.FileName, err.Error())
+	}
+	return &RecordInFile{Record: *rec, FileName: pos.FileName}, nil
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 同时以文本格式和二进制格式保存相同的记录，返回两个文件的内容
+func writeTextAndBinary(t *testing.T) ([]byte, []byte) {
+	err := ioutil.WriteFile("./in.txt", []byte(File1+"\n"+File2+"\n"+File3), 0644)
+	assert.Nil(t, err)
+	priv, err := GenerateSigningKey()
+	assert.Nil(t, err)
+	opts := &ConvertOptions{SigningKey: priv, PublishDate: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}
+	recList, err := ExtractRecordsFromRawFileWithOptions("./in.txt", opts)
+	assert.Nil(t, err)
+	os.RemoveAll("./in.txt")
+	recList[0].IncidentDate = time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)
+	recList[0].Sign(priv)
+	tomb := NewTombstone(recList[1], "")
+	tomb.Sign(priv)
+	recList = append(recList, tomb)
+
+	records := NewRecords()
+	for _, rec := range recList {
+		records.Add(*rec, 0)
+	}
+	var text, bin bytes.Buffer
+	assert.Nil(t, records.WriteToFile(&text))
+	assert.Nil(t, records.WriteToBinary(&bin))
+	return text.Bytes(), bin.Bytes()
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	text, bin := writeTextAndBinary(t)
+	assert.True(t, len(bin) < len(text)*3/4, "%d %d", len(bin), len(text)) //签名无法压缩，记录很少时比例较高
+	err := ioutil.WriteFile("./rt.yinao.txt", text, 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./rt.yinao.txt")
+	err = ioutil.WriteFile("./rt.yinao.bin", bin, 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./rt.yinao.bin")
+
+	textHdr, textRecs, err := ExtractRecordsFromEncFile("./rt.yinao.txt")
+	assert.Nil(t, err)
+	binHdr, binRecs, err := ExtractRecordsFromEncFile("./rt.yinao.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, textHdr, binHdr)
+	assert.Equal(t, textRecs, binRecs)
+
+	// 二进制格式转回文本格式之后，与原来的文件完全相同
+	var b bytes.Buffer
+	assert.Nil(t, WriteRecordsToFileWithHeader(binHdr, binRecs, &b))
+	assert.Equal(t, string(text), b.String())
+
+	// 合并时也可以读取二进制格式的文件
+	os.MkdirAll("./bin", os.ModePerm)
+	defer os.RemoveAll("./bin")
+	err = ioutil.WriteFile("./bin/a.yinao.bin", bin, 0644)
+	assert.Nil(t, err)
+	records := NewRecords()
+	records.AddEncRecordsInDir("./bin", 0, &b)
+	b.Reset()
+	assert.Nil(t, records.WriteToFile(&b))
+	assert.Equal(t, string(text), b.String())
+}
+
+func TestBinaryDB(t *testing.T) {
+	text, bin := writeTextAndBinary(t)
+	err := ioutil.WriteFile("./q.yinao.txt", text, 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./q.yinao.txt")
+	err = ioutil.WriteFile("./q.yinao.bin", bin, 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./q.yinao.bin")
+
+	textDB, err := NewDBFromFiles([]string{"./q.yinao.txt"})
+	assert.Nil(t, err)
+	defer textDB.Close()
+	binDB, err := NewDBFromFiles([]string{"./q.yinao.bin"})
+	assert.Nil(t, err)
+	defer binDB.Close()
+	assert.Equal(t, textDB.Len(), binDB.Len())
+	assert.Equal(t, len(textDB.IDMap), len(binDB.IDMap)) //身份证号为NA的记录不在索引中
+	assert.Equal(t, len(textDB.tombs), len(binDB.tombs))
+
+	for _, info := range []string{"张若虚，男，2019", "张若美，女，2018", "李若美，女，1988"} {
+		expected, err := textDB.SearchBaseInfo(info)
+		assert.Nil(t, err)
+		actual, err := binDB.SearchBaseInfo(info)
+		assert.Nil(t, err)
+		assert.Equal(t, len(expected), len(actual))
+		for i := range expected {
+			assert.Equal(t, expected[i].Record, actual[i].Record)
+		}
+	}
+	expected, err := textDB.SearchID("11010920190401961X")
+	assert.Nil(t, err)
+	actual, err := binDB.SearchID("11010920190401961X")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(actual))
+	assert.Equal(t, expected[0].Record, actual[0].Record)
+	for _, db := range []*DB{textDB, binDB} {
+		actual, err = db.SearchID("11010920180401984X")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(actual)) //已被撤回
+	}
+
+	var b bytes.Buffer
+	assert.Nil(t, binDB.ExportNDJSON(&b))
+	assert.Contains(t, b.String(), `"file_name":"./q.yinao.bin"`)
+}
+
+func TestBinaryCorrupted(t *testing.T) {
+	_, bin := writeTextAndBinary(t)
+	defer os.RemoveAll("./bad.yinao.bin")
+	corrupted := append([]byte{}, bin...)
+	corrupted[len(corrupted)/2] ^= 1
+	for _, data := range [][]byte{corrupted, bin[:len(bin)-1], []byte("YINAOBIN")} {
+		err := ioutil.WriteFile("./bad.yinao.bin", data, 0644)
+		assert.Nil(t, err)
+		_, err = NewDBFromFiles([]string{"./bad.yinao.bin"})
+		assert.NotNil(t, err)
+		_, _, err = ExtractRecordsFromEncFile("./bad.yinao.bin")
+		assert.NotNil(t, err)
+	}
+	_, err := parseBinFile(corrupted)
+	assert.Contains(t, err.Error(), "校验和错误")
+
+	// 重新计算了校验和的伪造文件，在载入时就会因为记录的校验码错误而失败，不会等到查询时才发现
+	bf, err := parseBinFile(bin)
+	assert.Nil(t, err)
+	forged := append([]byte{}, bin...)
+	forged[bf.start+2*sha256.Size+7] ^= 1 //第一条记录的校验码
+	resealBin(forged)
+	assert.Nil(t, ioutil.WriteFile("./bad.yinao.bin", forged, 0644))
+	_, err = NewDBFromFiles([]string{"./bad.yinao.bin"})
+	assert.Contains(t, err.Error(), "校验码错误")
+	var errLog bytes.Buffer
+	_, err = extractEncRecordsFromFile("./bad.yinao.bin", &errLog, func(hdr *FileHeader, rec *Record, off int64) error { return nil })
+	assert.Nil(t, err)
+	assert.Contains(t, errLog.String(), "校验码错误")
+
+	// 少算了一条记录时，最后一条记录成了多余的内容
+	var w binWriter
+	w.uvarint(uint64(bf.end - bf.start))
+	forged = append([]byte{}, bin...)
+	forged[bf.start-w.Len()-1]-- //记录的条数只有一个字节
+	resealBin(forged)
+	assert.Nil(t, ioutil.WriteFile("./bad.yinao.bin", forged, 0644))
+	_, err = NewDBFromFiles([]string{"./bad.yinao.bin"})
+	assert.Contains(t, err.Error(), "多余的内容")
+	_, _, err = ExtractRecordsFromEncFile("./bad.yinao.bin")
+	assert.Contains(t, err.Error(), "多余的内容")
+
+	// 压缩比过高的描述表不会被完全解压
+	var b bytes.Buffer
+	rec := NewRecord("张三，男，2000", "NA", 80, strings.Repeat("a", 16<<20))
+	assert.Nil(t, WriteRecordsToBinary(nil, []*Record{rec}, &b))
+	assert.True(t, b.Len() < 1<<16)
+	_, err = parseBinFile(b.Bytes())
+	assert.Contains(t, err.Error(), "恶意构造")
+}
+
+// 重新计算二进制格式的文件末尾的sha256
+func resealBin(data []byte) {
+	body := data[:len(data)-sha256.Size]
+	sum := sha256.Sum256(body)
+	copy(data[len(body):], sum[:])
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	BloomFileSuffix          = ".yinao.bloom" // 布隆过滤器文件的后缀
+	DefaultFalsePositiveRate = 0.001          // 默认的误报率
+	bloomMagic               = "YINAOBLM"     // 布隆过滤器文件开头的8个字节
+	bloomVersion             = 1              // 布隆过滤器文件格式的版本
+	maxBloomHashes           = 32             // 哈希函数个数的上限
+)
+
+// 由各条记录的BaseInfoHash和IDHash构成的布隆过滤器。它只能回答“可能有记录”或者“一定没有记录”，
+// 不包含任何描述，适合只需要初步筛查的小诊所使用，可能有记录时再向其他医院查询详细信息
+type BloomFilter struct {
+	Header FileHeader // 计算哈希值所用的哈希方案和规范化方法，与加密记录文件的头部相同
+	Count  int        // 加入的哈希值个数
+	k      int        // 每个哈希值对应的位数
+	bits   []byte
+	hasher Hasher // 查询时计算哈希值的方法，从文件中读取时创建，为nil时只能查询不带密钥的哈希方案
+}
+
+// 创建一个空的布隆过滤器，它在加入n个哈希值之后的误报率约为fpRate
+func NewBloomFilter(hdr *FileHeader, n int, fpRate float64) (*BloomFilter, error) {
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, fmt.Errorf("误报率必须大于0并且小于1：%g", fpRate)
+	}
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > maxBloomHashes {
+		k = maxBloomHashes
+	}
+	f := &BloomFilter{Header: *hdr, k: k, bits: make([]byte, (int(m)+7)/8)}
+	f.Header.Version = FormatVersion //写入文件时总是使用本程序的格式版本
+	return f, nil
+}
+
+// 哈希值在过滤器中对应的各个位。哈希值本身已经是均匀分布的，所以直接用它的前16个字节进行双重哈希
+func (f *BloomFilter) positions(hash [sha256.Size]byte) []uint64 {
+	m := uint64(len(f.bits)) * 8
+	h1 := binary.BigEndian.Uint64(hash[:8])
+	h2 := binary.BigEndian.Uint64(hash[8:16]) | 1
+	res := make([]uint64, f.k)
+	for i := range res {
+		res[i] = (h1 + uint64(i)*h2) % m
+	}
+	return res
+}
+
+// 加入一个哈希值
+func (f *BloomFilter) Add(hash [sha256.Size]byte) {
+	for _, p := range f.positions(hash) {
+		f.bits[p/8] |= 1 << (p % 8)
+	}
+	f.Count++
+}
+
+// 过滤器中是否可能有这个哈希值，返回false时一定没有
+func (f *BloomFilter) Test(hash [sha256.Size]byte) bool {
+	for _, p := range f.positions(hash) {
+		if f.bits[p/8]&(1<<(p%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 按过滤器的大小和加入的哈希值个数估计的误报率
+func (f *BloomFilter) FalsePositiveRate() float64 {
+	m := float64(len(f.bits)) * 8
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.Count)/m), float64(f.k))
+}
+
+// 用各条记录的BaseInfoHash和IDHash创建布隆过滤器，撤回记录不会被加入。
+// 这里不知道群组密钥，无法算出NA的哈希值，所以身份证号为NA的记录的IDHash也会被加入，由MayContainID拒绝按NA筛查
+func BloomFilterFromRecords(hdr *FileHeader, recList []*Record, fpRate float64) (*BloomFilter, error) {
+	n := 0
+	for _, rec := range recList {
+		if !rec.IsTombstone() {
+			n += 2
+		}
+	}
+	f, err := NewBloomFilter(hdr, n, fpRate)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recList {
+		if !rec.IsTombstone() {
+			f.Add(rec.BaseInfoHash)
+			f.Add(rec.IDHash)
+		}
+	}
+	return f, nil
+}
+
+// 用各条记录创建布隆过滤器，已被撤回的记录不会被加入
+func (recs *Records) BloomFilter(fpRate float64) (*BloomFilter, error) {
+	hdr := &FileHeader{Scheme: recs.scheme, Creator: recs.Creator, Normalization: recs.normalization}
+	return BloomFilterFromRecords(hdr, recs.sorted(), fpRate)
+}
+
+// 将布隆过滤器写入文件。所有整数都是大端序，变长整数使用uvarint编码：
+//  1. 8字节的bloomMagic和2字节的格式版本
+//  2. 文件头部：变长整数表示的长度，以及与加密记录文件相同的头部（各行用\n隔开）
+//  3. 变长整数表示的哈希值个数和每个哈希值对应的位数
+//  4. 变长整数表示的字节数，以及过滤器的各位
+//  5. 以上所有内容的sha256
+func (f *BloomFilter) WriteToFile(file io.Writer) error {
+	var w binWriter
+	w.WriteString(bloomMagic)
+	binary.BigEndian.PutUint16(w.tmp[:2], bloomVersion)
+	w.Write(w.tmp[:2])
+	w.bytes([]byte(strings.Join(f.Header.ToLines(), "\n")))
+	w.uvarint(uint64(f.Count))
+	w.uvarint(uint64(f.k))
+	w.bytes(f.bits)
+	sum := sha256.Sum256(w.Bytes())
+	w.Write(sum[:])
+	_, err := file.Write(w.Bytes())
+	return err
+}
+
+// 从r中读取布隆过滤器，secret是群组密钥，用于查询使用带密钥哈希方案的过滤器，不需要时可以为nil
+func ReadBloomFilter(r io.Reader, secret []byte) (*BloomFilter, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(bloomMagic)+2+sha256.Size || string(data[:len(bloomMagic)]) != bloomMagic {
+		return nil, fmt.Errorf("不是布隆过滤器文件")
+	}
+	body := data[:len(data)-sha256.Size]
+	if sum := sha256.Sum256(body); !bytes.Equal(sum[:], data[len(body):]) {
+		return nil, fmt.Errorf("文件的校验和错误，文件可能已经损坏")
+	}
+	if v := binary.BigEndian.Uint16(data[len(bloomMagic):]); v != bloomVersion {
+		return nil, fmt.Errorf("布隆过滤器的版本%d与本程序所使用的版本%d不同，请升级本程序", v, bloomVersion)
+	}
+	br := bytes.NewReader(body[len(bloomMagic)+2:])
+	hdrText, err := readBinBytes(br, br.Len())
+	if err != nil {
+		return nil, fmt.Errorf("文件头部的格式错误：%s", err.Error())
+	}
+	lines := strings.Split(string(hdrText), "\n")
+	if !isHeader(lines) {
+		return nil, fmt.Errorf("文件头部的格式错误")
+	}
+	hdr, err := parseHeader(lines)
+	if err != nil {
+		return nil, err
+	}
+	f := &BloomFilter{Header: *hdr}
+	count, err := binary.ReadUvarint(br)
+	if err != nil || count > math.MaxInt32 {
+		return nil, fmt.Errorf("过滤器的格式错误")
+	}
+	k, err := binary.ReadUvarint(br)
+	if err != nil || k < 1 || k > maxBloomHashes {
+		return nil, fmt.Errorf("过滤器的格式错误")
+	}
+	f.Count, f.k = int(count), int(k)
+	if f.bits, err = readBinBytes(br, br.Len()); err != nil || len(f.bits) == 0 {
+		return nil, fmt.Errorf("过滤器的格式错误")
+	}
+	if br.Len() != 0 {
+		return nil, fmt.Errorf("文件的末尾有多余的内容")
+	}
+	if f.Count != 0 {
+		if f.hasher, err = ParseHasher(hdr.Scheme, secret); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// 读取布隆过滤器文件，secret是群组密钥，不需要时可以为nil
+func LoadBloomFilter(fname string, secret []byte) (*BloomFilter, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	f, err := ReadBloomFilter(file, secret)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
+	}
+	return f, nil
+}
+
+// 过滤器中是否可能有list中某个明文的哈希值
+func (f *BloomFilter) testAny(list []string) (bool, error) {
+	if f.Count == 0 {
+		return false, nil
+	}
+	h := f.hasher
+	if h == nil {
+		var err error
+		if h, err = ParseHasher(f.Header.Scheme, nil); err != nil {
+			return false, err
+		}
+	}
+	for _, s := range list {
+		if f.Test(h.Sum(s)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 按基本信息的明文进行初步筛查，与DB.SearchBaseInfo一样，也会对出生年份加一和减一。返回true时表示可能有记录
+func (f *BloomFilter) MayContainBaseInfo(info string) (bool, error) {
+	if err := CheckBaseInfo(info); err != nil {
+		return false, err
+	}
+	return f.testAny(BaseInfoVariants([]int{f.Header.Normalization}, info))
+}
+
+// 按身份证号的明文进行初步筛查，返回true时表示可能有记录。与DB.SearchID一样，按NA筛查时总是没有记录
+func (f *BloomFilter) MayContainID(id string) (bool, error) {
+	if err := CheckID(id); err != nil {
+		return false, err
+	}
+	if id == "NA" {
+		return false, nil
+	}
+	return f.testAny(IDVariants([]int{f.Header.Normalization}, id))
+}
+
+// 与DB.SearchIDWithName一样，同时按身份证号和由身份证号生成的基本信息进行初步筛查
+func (f *BloomFilter) MayContainIDWithName(id, name string) (bool, error) {
+	info, err := BaseInfoFromID(name, id)
+	if err != nil {
+		return false, err
+	}
+	if ok, err := f.MayContainID(id); ok || err != nil {
+		return ok, err
+	}
+	return f.MayContainBaseInfo(info)
+}
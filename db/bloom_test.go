@@ -0,0 +1,101 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	err := ioutil.WriteFile("./in.txt", []byte(File1+"\n"+File2+"\n"+File3), 0644)
+	assert.Nil(t, err)
+	recList, err := ExtractRecordsFromRawFile("./in.txt")
+	assert.Nil(t, err)
+	os.RemoveAll("./in.txt")
+	priv, _ := GenerateSigningKey()
+	recList[2].Sign(priv)
+	records := NewRecords()
+	for _, rec := range recList {
+		records.Add(*rec, 0)
+	}
+	tomb := NewTombstone(recList[2], "")
+	tomb.Sign(priv)
+	records.Add(*tomb, 0) //被撤回的记录不会被加入过滤器
+
+	filter, err := records.BloomFilter(DefaultFalsePositiveRate)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*(records.Len()-1), filter.Count)
+	var b bytes.Buffer
+	assert.Nil(t, filter.WriteToFile(&b))
+	assert.NotContains(t, b.String(), recList[0].Description)
+	err = ioutil.WriteFile("./f.yinao.bloom", b.Bytes(), 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./f.yinao.bloom")
+	loaded, err := LoadBloomFilter("./f.yinao.bloom", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, filter.Header, loaded.Header)
+
+	for _, f := range []*BloomFilter{filter, loaded} {
+		ok, err := f.MayContainBaseInfo("张若虚，男，2019")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = f.MayContainBaseInfo("张若虚， 男，2018") //出生年份加一，并且需要规范化
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = f.MayContainID("11010920180401984X")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = f.MayContainIDWithName("11010920190401961X", "张若虚")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = f.MayContainID("NA") //李若美的身份证号为NA，但不能按NA筛查出来
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		ok, err = f.MayContainID("11010919990401881X")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		ok, err = f.MayContainBaseInfo("王五，男，1950")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		_, err = f.MayContainID("123")
+		assert.NotNil(t, err)
+	}
+
+	// 实际的误报率与设定的误报率相近
+	filter, err = NewBloomFilter(&FileHeader{Scheme: SchemeSHA256}, 10000, 0.01)
+	assert.Nil(t, err)
+	for i := 0; i < 10000; i++ {
+		filter.Add(SHA256Hasher.Sum(fmt.Sprint("in", i)))
+	}
+	positives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.Test(SHA256Hasher.Sum(fmt.Sprint("out", i))) {
+			positives++
+		}
+	}
+	assert.True(t, positives > 50 && positives < 200, "%d", positives)
+	assert.InDelta(t, 0.01, filter.FalsePositiveRate(), 0.002)
+	_, err = NewBloomFilter(&FileHeader{Scheme: SchemeSHA256}, 10, 0)
+	assert.NotNil(t, err)
+}
+
+func TestBloomFilterCorrupted(t *testing.T) {
+	filter, err := NewBloomFilter(&FileHeader{Version: FormatVersion, Scheme: SchemeHMACSHA256 + "/abc"}, 1, 0.01)
+	assert.Nil(t, err)
+	filter.Add(SHA256Hasher.Sum("a"))
+	var b bytes.Buffer
+	assert.Nil(t, filter.WriteToFile(&b))
+	_, err = ReadBloomFilter(bytes.NewReader(b.Bytes()), nil) //带密钥的哈希方案需要群组密钥
+	assert.NotNil(t, err)
+
+	data := b.Bytes()
+	data[len(data)/2] ^= 1
+	_, err = ReadBloomFilter(bytes.NewReader(data), []byte("secret"))
+	assert.Contains(t, err.Error(), "校验和错误")
+	_, err = ReadBloomFilter(bytes.NewReader([]byte(File1)), nil)
+	assert.Contains(t, err.Error(), "不是布隆过滤器文件")
+}
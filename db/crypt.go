@@ -0,0 +1,162 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	EncDescPrefix = "enc1:" // 加密后的描述以此开头
+
+	descKeyDomain    = "YinaoBlacklist description key\x00"
+	contentKeyDomain = "YinaoBlacklist content key\x00"
+)
+
+var errDecrypt = errors.New("无法解密描述，患者的身份信息不匹配")
+
+// 从患者的身份信息（基本信息或者身份证号）推导出加密描述所用的密钥。
+// 它与记录中的哈希值使用相同的哈希方法，但是明文加上了不同的前缀，因此从文件中的哈希值无法得到密钥
+func descKey(h Hasher, identity string) [sha256.Size]byte {
+	return h.Sum(descKeyDomain + identity)
+}
+
+// 用HMAC-SHA256计算data各部分的消息认证码，各部分之前加上长度，以免拼接的方式不同时得到相同的结果
+func mac(key []byte, data ...[]byte) []byte {
+	m := hmac.New(sha256.New, key)
+	var n [8]byte
+	for _, d := range data {
+		binary.BigEndian.PutUint64(n[:], uint64(len(d)))
+		m.Write(n[:])
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+// 用AES-256-GCM加密，返回随机数与密文拼接的结果，ad是需要一同认证的附加数据。
+// 随机数由密钥、明文和附加数据推导出来（类似SIV），同一条记录加密多次得到相同的结果，合并时才能去重。
+// 只有明文和附加数据都相同时随机数才会重复，此时密文也相同，不会泄露更多信息
+func seal(key []byte, plaintext []byte, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(nonce, mac(key, plaintext, ad))
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// 解密seal的结果
+func open(key []byte, data []byte, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errDecrypt
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plaintext, nil
+}
+
+// 加密描述时需要一同认证的附加数据，它使得加密后的描述无法被挪到其他记录中
+func (rec *Record) descAD() []byte {
+	ad := make([]byte, 0, 2*sha256.Size)
+	ad = append(ad, rec.BaseInfoHash[:]...)
+	return append(ad, rec.IDHash[:]...)
+}
+
+// 描述是否已被加密
+func (rec *Record) IsDescriptionEncrypted() bool {
+	return strings.HasPrefix(rec.Description, EncDescPrefix)
+}
+
+// 加密记录中的描述，并重新计算校验码。h必须是计算这条记录的哈希值时所用的哈希方法。
+// 描述用一个内容密钥加密，内容密钥再分别用基本信息和身份证号推导出的密钥加密，
+// 因此知道其中任何一项的人都能解密。内容密钥由基本信息推导出的密钥和描述推导出来，
+// 同一条原始记录无论转换几次、由谁转换，加密结果都相同。加密后的描述为：
+//
+//	enc1:<用基本信息加密的内容密钥>:<用身份证号加密的内容密钥>:<加密后的描述>
+//
+// 各部分都是base64编码，身份证号为NA时第二部分为空
+func (rec *Record) EncryptDescription(h Hasher, baseInfo, id string) error {
+	if rec.IsDescriptionEncrypted() {
+		return fmt.Errorf("描述已经被加密过了")
+	}
+	ad := rec.descAD()
+	baseKey := descKey(h, baseInfo)
+	contentKey := mac(baseKey[:], []byte(contentKeyDomain), []byte(id), ad, []byte(rec.Description))
+	parts := make([]string, 3)
+	for i, identity := range [2]string{baseInfo, id} {
+		if i == 1 && identity == "NA" {
+			continue
+		}
+		k := descKey(h, identity)
+		wrapped, err := seal(k[:], contentKey, ad)
+		if err != nil {
+			return err
+		}
+		parts[i] = base64.StdEncoding.EncodeToString(wrapped)
+	}
+	ciphertext, err := seal(contentKey, []byte(rec.Description), ad)
+	if err != nil {
+		return err
+	}
+	parts[2] = base64.StdEncoding.EncodeToString(ciphertext)
+	rec.Description = EncDescPrefix + strings.Join(parts, ":")
+	rec.Crc32 = rec.checksum()
+	return nil
+}
+
+// 用患者的基本信息或者身份证号解密描述，不知道的那一项可以为空字符串。h必须是计算这条记录的哈希值时所用的哈希方法
+func (rec *Record) DecryptDescription(h Hasher, baseInfo, id string) (string, error) {
+	if !rec.IsDescriptionEncrypted() {
+		return rec.Description, nil
+	}
+	parts := strings.Split(rec.Description[len(EncDescPrefix):], ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("加密描述的格式错误：%s", rec.Description)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("加密描述的格式错误：%s", rec.Description)
+	}
+	ad := rec.descAD()
+	for i, identity := range [2]string{baseInfo, id} {
+		if len(identity) == 0 || len(parts[i]) == 0 {
+			continue
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(parts[i])
+		if err != nil {
+			return "", fmt.Errorf("加密描述的格式错误：%s", rec.Description)
+		}
+		k := descKey(h, identity)
+		contentKey, err := open(k[:], wrapped, ad)
+		if err != nil {
+			continue
+		}
+		plaintext, err := open(contentKey, ciphertext, ad)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	}
+	return "", errDecrypt
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDescription(t *testing.T) {
+	h := NewHMACHasher([]byte("correct horse battery staple"))
+	desc := "江流宛转绕芳甸，月照花林皆似霰。\\n空里流霜不觉飞，汀上白沙看不见。"
+	rec := NewRecordWithHasher(h, "张若美，女，2018", "11010920180401984X", 98.0, desc)
+	err := rec.EncryptDescription(h, "张若美，女，2018", "11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.True(t, rec.IsDescriptionEncrypted())
+	assert.True(t, rec.VerifyChecksum())
+	assert.False(t, strings.Contains(rec.Description, "江流"))
+	assert.NotEqual(t, nil, rec.EncryptDescription(h, "张若美，女，2018", "11010920180401984X"))
+
+	// 加密后的记录可以被正常地写入和读取
+	var errLog bytes.Buffer
+	parsed := parseLines(rec.ToLines(), &errLog)
+	assert.Equal(t, "", errLog.String())
+	assert.Equal(t, rec, parsed)
+
+	plain, err := rec.DecryptDescription(h, "张若美，女，2018", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, desc, plain)
+	plain, err = rec.DecryptDescription(h, "", "11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, desc, plain)
+	_, err = rec.DecryptDescription(h, "张若美，女，2019", "")
+	assert.NotEqual(t, nil, err)
+	_, err = rec.DecryptDescription(SHA256Hasher, "张若美，女，2018", "")
+	assert.NotEqual(t, nil, err)
+
+	// 加密后的描述无法被挪到其他记录中
+	other := NewRecordWithHasher(h, "张若美，女，2018", "11010920180401992X", 98.0, "")
+	other.Description = rec.Description
+	_, err = other.DecryptDescription(h, "张若美，女，2018", "")
+	assert.NotEqual(t, nil, err)
+
+	// 身份证号为NA时只能用基本信息解密
+	rec = NewRecordWithHasher(h, "李若美，女，1988", "NA", 8.0, desc)
+	err = rec.EncryptDescription(h, "李若美，女，1988", "NA")
+	assert.Equal(t, nil, err)
+	_, err = rec.DecryptDescription(h, "", "NA")
+	assert.NotEqual(t, nil, err)
+	plain, err = rec.DecryptDescription(h, "李若美，女，1988", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, desc, plain)
+}
+
+func TestSearchEncryptedDescription(t *testing.T) {
+	err := ioutil.WriteFile("./in.txt", []byte(File1), 0644)
+	assert.Equal(t, nil, err)
+	opts := &ConvertOptions{EncryptDescription: true}
+	recList, err := ExtractRecordsFromRawFileWithOptions("./in.txt", opts)
+	assert.Equal(t, nil, err)
+	var b bytes.Buffer
+	err = WriteRecordsToFileWithHeader(opts.Header(), recList, &b)
+	assert.Equal(t, nil, err)
+	assert.False(t, strings.Contains(b.String(), "春江"))
+	err = ioutil.WriteFile("./A.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	assert.Equal(t, nil, err)
+	res, err := db.SearchBaseInfo("张若虚，男，2020")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+	assert.True(t, res[0].Decrypted)
+	assert.Equal(t, "春江潮水连海平，海上明月共潮生。\\n滟滟随波千万里，何处春江无月明？", res[0].Description)
+
+	res, err = db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+	assert.True(t, res[0].Decrypted)
+	assert.Equal(t, "江流宛转绕芳甸，月照花林皆似霰。\\n空里流霜不觉飞，汀上白沙看不见。", res[0].Description)
+	db.Close()
+
+	os.RemoveAll("./in.txt")
+	os.RemoveAll("./A.yinao.txt")
+}
+
+func TestConvertTwiceAndMerge(t *testing.T) {
+	// 同一份原始记录被转换两次（例如两家医院提交了同一个病例），加密后的描述相同，合并之后只剩一份
+	err := ioutil.WriteFile("./in.txt", []byte(File1), 0644)
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll("./in.txt")
+	priv, _ := GenerateSigningKey()
+	records := NewRecords()
+	n := 0
+	for i, fname := range []string{"./A.yinao.txt", "./B.yinao.txt"} {
+		opts := &ConvertOptions{EncryptDescription: true, SigningKey: priv, PublishDate: time.Date(2020, 5, 1+i, 0, 0, 0, 0, time.UTC)}
+		recList, err := ExtractRecordsFromRawFileWithOptions("./in.txt", opts)
+		assert.Equal(t, nil, err)
+		n = len(recList)
+		var b bytes.Buffer
+		err = WriteRecordsToFileWithHeader(opts.Header(), recList, &b)
+		assert.Equal(t, nil, err)
+		err = ioutil.WriteFile(fname, b.Bytes(), 0644)
+		assert.Equal(t, nil, err)
+		defer os.RemoveAll(fname)
+		var errLog bytes.Buffer
+		err = records.AddEncRecordsInFile(fname, 0, &errLog)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "", errLog.String())
+	}
+	assert.Equal(t, n, records.Len())
+}
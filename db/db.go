@@ -1,13 +1,15 @@
 package db
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"sort"
-	"strings"
+	"sync"
+	"time"
 )
 
 type Position struct {
@@ -17,17 +19,71 @@ type Position struct {
 
 type PositionMap = map[[8]byte][]Position // 为了节省内存，索引只使用了最低的8个字节作为键
 
-// 用于查询医闹记录的数据库
+// 用于查询医闹记录的数据库。载入之后，多个goroutine可以同时对它进行查询，
+// 但Decay应当在开始查询之前设置好，以后不再修改
 type DB struct {
-	FileMap     map[string]*os.File // 保存若干已打开的文件
-	BaseInfoMap PositionMap         // 从BaseInfoHash的低8个字节定位到记录在文件中的位置
-	IDMap       PositionMap         // 从IDHash的低8个字节定位到记录在文件中的位置
+	FileMap     map[string]*os.File    // 保存若干已打开的文件
+	HeaderMap   map[string]*FileHeader // 保存各个文件的头部
+	BaseInfoMap PositionMap            // 从BaseInfoHash的低8个字节定位到记录在文件中的位置
+	IDMap       PositionMap            // 从IDHash的低8个字节定位到记录在文件中的位置
+	Decay       *DecayPolicy           // 查询时对置信参数进行衰减的策略，为nil时不衰减
+	hashers     []Hasher               // 各个文件所使用的哈希方法，相同的哈希方案只保留一个
+	versions    []int                  // 各个文件所使用的规范化方法的版本，相同的版本只保留一个
+	tombs       tombstones             // 各个文件中的撤回记录，它们不被索引，只用来过滤查询结果
+	indexes     map[string]*fileIndex  // 各个文件的索引，重新载入某个文件时，用它们重建整个数据库的索引
+	keys        [2][][8]byte           // BaseInfoMap和IDMap中的各个键，已排序，用于按哈希值的前缀查询
+
+	fileList []string     // 载入的各个文件，按照载入的顺序排列
+	opts     *LoadOptions // 载入时所用的选项，重新载入时也使用它们
+
+	mu       sync.RWMutex  // 保护以上各个字段和已打开的文件，查询时持有读锁，替换索引和关闭时持有写锁
+	closed   bool          // 数据库是否已经关闭
+	stop     chan struct{} // 关闭数据库时通知Watch启动的goroutine退出
+	reloadMu sync.Mutex    // 保证同一时间只有一个goroutine在重新载入文件
+}
+
+// 数据库中记录的条数
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	n := 0
+	for _, posList := range db.BaseInfoMap { //每条记录都会在BaseInfoMap中被索引一次
+		n += len(posList)
+	}
+	return n
 }
 
+// 关闭数据库中已打开的文件，停止检查文件的变化，此后的查询都会返回错误
 func (db *DB) Close() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return
+	}
+	if db.stop != nil {
+		close(db.stop)
+	}
 	for _, file := range db.FileMap {
 		file.Close()
 	}
+	db.closed = true
+}
+
+// 查询时所用的各个哈希方法，以及各个文件所使用的规范化方法的版本
+func (db *DB) getHashers() ([]Hasher, []int) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.hashers, db.versions
+}
+
+// 已载入的文件所使用的各个哈希方案和规范化方法的版本，按前缀查询的客户端需要用它们在本地计算哈希值
+func (db *DB) Schemes() ([]string, []int) {
+	hashers, versions := db.getHashers()
+	schemes := make([]string, len(hashers))
+	for i, h := range hashers {
+		schemes[i] = h.Scheme()
+	}
+	return schemes, versions
 }
 
 func appendPostion(m PositionMap, buf [8]byte, pos Position) {
@@ -38,71 +94,286 @@ func appendPostion(m PositionMap, buf [8]byte, pos Position) {
 	m[buf] = append(posList, pos)
 }
 
+// 根据哈希方案从hashers中找到查询时所用的哈希方法，如果还没有这种方法，则创建它并加入hashers
+func addHasher(hashers []Hasher, scheme string, secret []byte) ([]Hasher, error) {
+	for _, h := range hashers {
+		if h.Scheme() == scheme {
+			return hashers, nil
+		}
+	}
+	h, err := ParseHasher(scheme, secret)
+	if err != nil {
+		return nil, err
+	}
+	return append(hashers, h), nil
+}
+
 // 利用若干文件初始化数据库
 func NewDBFromFiles(fnameList []string) (*DB, error) {
-	var buf [8]byte
-	shaNA := sha256.Sum256([]byte("NA"))
-	db := &DB{
-		FileMap:     make(map[string]*os.File),
-		BaseInfoMap: make(PositionMap),
-		IDMap:       make(PositionMap),
+	return NewDBFromFilesWithSecret(fnameList, nil)
+}
+
+// 利用若干文件初始化数据库，secret是群组密钥，用于查询使用带密钥哈希方案的文件，不需要时可以为nil
+func NewDBFromFilesWithSecret(fnameList []string, secret []byte) (*DB, error) {
+	return NewDBFromFilesWithOptions(fnameList, &LoadOptions{Secret: secret})
+}
+
+// 载入加密记录文件时所使用的选项
+type LoadOptions struct {
+	Secret   []byte // 群组密钥，用于查询使用带密钥哈希方案的文件，不需要时可以为nil
+	UseIndex bool   // 是否使用保存在文件旁边的索引，索引不存在或者已经过期时会重新扫描文件并保存索引
+}
+
+// 按照opts利用若干文件初始化数据库
+func NewDBFromFilesWithOptions(fnameList []string, opts *LoadOptions) (*DB, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	db := &DB{opts: opts}
+	files := make(map[string]*os.File)
+	indexes := make(map[string]*fileIndex)
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
 	}
 	for _, fname := range fnameList {
-		err := extractRecordsFromFile(fname, func(recLines []string, off int64) error {
-			pos := Position{FileName: fname, Offset: off}
-			var b bytes.Buffer
-			rec := parseLines(recLines, &b)
-			if b.Len() != 0 {
-				return fmt.Errorf("读取文件%s时，遇到错误：%s\n", pos.FileName, b.String())
-			}
-			if rec != nil {
-				copy(buf[:], rec.BaseInfoHash[:8])
-				appendPostion(db.BaseInfoMap, buf, pos)
-			}
-			if rec != nil && !bytes.Equal(rec.IDHash[:], shaNA[:]) {
-				copy(buf[:], rec.IDHash[:8])
-				appendPostion(db.IDMap, buf, pos)
-			}
-			return nil
-		})
+		if _, ok := files[fname]; ok { //同一个文件只载入一次
+			continue
+		}
+		f, idx, err := openAndIndex(fname, opts)
 		if err != nil {
+			closeAll()
 			return nil, err
 		}
-		db.FileMap[fname], _ = os.Open(fname)
+		files[fname], indexes[fname] = f, idx
+		db.fileList = append(db.fileList, fname)
+	}
+	if err := db.install(files, indexes); err != nil {
+		closeAll()
+		return nil, err
 	}
 	return db, nil
 }
 
+// 用各个文件的索引重建整个数据库的索引，然后在写锁的保护下，一次性地替换掉旧的索引和文件。
+// 正在进行的查询会在替换之前完成，此后的查询都使用新的索引和文件
+func (db *DB) install(files map[string]*os.File, indexes map[string]*fileIndex) error {
+	var hashers []Hasher
+	var versions []int
+	headerMap := make(map[string]*FileHeader)
+	baseInfoMap := make(PositionMap)
+	idMap := make(PositionMap)
+	tombs := make(tombstones)
+	for _, fname := range db.fileList {
+		idx := indexes[fname]
+		if len(idx.BaseInfo) != 0 || len(idx.Tombstones) != 0 {
+			var err error
+			if hashers, err = addHasher(hashers, idx.Header.Scheme, db.opts.Secret); err != nil {
+				return fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
+			}
+		}
+		if !containsInt(versions, idx.Header.Normalization) {
+			versions = append(versions, idx.Header.Normalization)
+		}
+		for _, entry := range idx.BaseInfo {
+			appendPostion(baseInfoMap, entry.Key, Position{FileName: fname, Offset: entry.Offset})
+		}
+		for _, entry := range idx.ID {
+			appendPostion(idMap, entry.Key, Position{FileName: fname, Offset: entry.Offset})
+		}
+		for i := range idx.Tombstones {
+			tombs.add(&idx.Tombstones[i])
+		}
+		hdr := idx.Header
+		headerMap[fname] = &hdr
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return fmt.Errorf("数据库已经关闭")
+	}
+	db.FileMap, db.HeaderMap, db.indexes = files, headerMap, indexes
+	db.BaseInfoMap, db.IDMap = baseInfoMap, idMap
+	db.keys = [2][][8]byte{sortedKeys(baseInfoMap), sortedKeys(idMap)}
+	db.hashers, db.versions, db.tombs = hashers, versions, tombs
+	return nil
+}
+
+// 索引中的各个键，按字节序排序
+func sortedKeys(m PositionMap) [][8]byte {
+	keys := make([][8]byte, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+	return keys
+}
+
+func containsInt(list []int, n int) bool {
+	for _, m := range list {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查已载入的文件是否有变化，重新载入有变化的文件，然后替换掉旧的索引和文件。
+// 返回被重新载入的文件；遇到错误（例如文件还没有写完）时，有错误的文件继续使用旧的索引和文件，下次检查时再重试
+func (db *DB) Reload() ([]string, error) {
+	db.reloadMu.Lock()
+	defer db.reloadMu.Unlock()
+	db.mu.RLock()
+	closed := db.closed
+	files := make(map[string]*os.File, len(db.FileMap))
+	for fname, f := range db.FileMap {
+		files[fname] = f
+	}
+	indexes := make(map[string]*fileIndex, len(db.indexes))
+	for fname, idx := range db.indexes {
+		indexes[fname] = idx
+	}
+	db.mu.RUnlock()
+	if closed {
+		return nil, fmt.Errorf("数据库已经关闭")
+	}
+
+	var reloaded []string
+	var oldFiles []*os.File
+	var firstErr error
+	for _, fname := range db.fileList {
+		fi, err := os.Stat(fname)
+		if err == nil && !indexes[fname].stale(fi) {
+			continue
+		}
+		var f *os.File
+		var idx *fileIndex
+		if err == nil {
+			f, idx, err = openAndIndex(fname, db.opts)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		oldFiles = append(oldFiles, files[fname])
+		files[fname], indexes[fname] = f, idx
+		reloaded = append(reloaded, fname)
+	}
+	if len(reloaded) == 0 {
+		return nil, firstErr
+	}
+	if err := db.install(files, indexes); err != nil {
+		for _, fname := range reloaded {
+			files[fname].Close()
+		}
+		return nil, err
+	}
+	for _, f := range oldFiles { //替换之后，已经没有查询在使用旧的文件了
+		f.Close()
+	}
+	return reloaded, firstErr
+}
+
+// 每隔interval检查一次已载入的文件，有变化时在后台重新载入它们。每次重新载入了文件或者遇到错误时，
+// 调用onReload（可以为nil）。数据库关闭时停止检查。这个函数只应调用一次
+func (db *DB) Watch(interval time.Duration, onReload func(reloaded []string, err error)) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return
+	}
+	db.stop = make(chan struct{})
+	stop := db.stop
+	db.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				reloaded, err := db.Reload()
+				if onReload != nil && (len(reloaded) != 0 || err != nil) {
+					onReload(reloaded, err)
+				}
+			}
+		}
+	}()
+}
+
+// 检查查询时将要读取的文件，在载入之后是否被原地修改过了（被替换为新文件时，已打开的仍是旧文件，不受影响）。
+// 调用者必须持有读锁
+func (db *DB) checkFile(fname string) error {
+	fi, err := db.FileMap[fname].Stat()
+	if err != nil {
+		return err
+	}
+	if db.indexes[fname].stale(fi) {
+		return fmt.Errorf("文件%s在载入之后被修改了，需要重新载入之后才能查询", fname)
+	}
+	return nil
+}
+
 type RecordInFile struct {
 	Record
-	FileName string
+	FileName  string
+	BaseInfo  string // 与BaseInfoHash相匹配的基本信息明文，仅在按明文查询时才会被填写
+	ID        string // 与IDHash相匹配的身份证号明文，仅在按明文查询时才会被填写
+	Decrypted bool   // Description是否是用查询时的明文解密之后的描述（此时Crc32是加密描述的校验码）
+	AgeDays   int    // 查询时记录的年龄（天数），没有日期的记录为-1
+}
+
+// 按明文查询时，用查询所用的明文解密记录中的描述，h是计算查询所用哈希值的哈希方法
+func (rec *RecordInFile) Decrypt(h Hasher) {
+	if !rec.IsDescriptionEncrypted() {
+		return
+	}
+	desc, err := rec.DecryptDescription(h, rec.BaseInfo, rec.ID)
+	if err == nil {
+		rec.Description = desc
+		rec.Decrypted = true
+	}
 }
 
-// 将记录转为6行纯文本
+// 将记录转为纯文本，第一行注明来源文件，接下来是记录的5行文本，如果记录带有日期或者签名，则在最后注明
 func (rec *RecordInFile) ToLines() []string {
-	var lines [6]string
+	lines := make([]string, 1, 8)
 	lines[0] = "======= 来自文件：" + rec.FileName
-	copy(lines[1:], rec.Record.ToLines())
-	return lines[:]
+	lines = append(lines, rec.Record.ToLines()[:5]...)
+	if rec.AgeDays >= 0 {
+		s := "======= 日期："
+		if !rec.IncidentDate.IsZero() {
+			s += "事件发生于" + rec.IncidentDate.Format(DateLayout) + "，"
+		}
+		if !rec.PublishDate.IsZero() {
+			s += "发布于" + rec.PublishDate.Format(DateLayout) + "，"
+		}
+		lines = append(lines, fmt.Sprintf("%s距今%d天", s, rec.AgeDays))
+	}
+	if rec.IsSigned() {
+		lines = append(lines, "======= 签名者："+rec.SignerID())
+	}
+	return lines
 }
 
-// 给定文件中的一个位置，利用已经打开的文件，从这个位置读取一个医闹记录出来
-func readRecord(fm map[string]*os.File, pos Position) (*RecordInFile, error) {
-	file := fm[pos.FileName]
-	_, err := file.Seek(pos.Offset, os.SEEK_SET)
+// 给定文件中的一个位置，利用已经打开的文件，从这个位置读取一个医闹记录出来。
+// 读取时使用ReadAt而不改变文件的当前位置，所以多个goroutine可以同时读取同一个文件
+func (db *DB) readRecord(pos Position) (*RecordInFile, error) {
+	file := db.FileMap[pos.FileName]
+	if idx := db.indexes[pos.FileName]; idx.Binary {
+		return readBinRecordAt(file, idx, pos)
+	}
+	recLines, _, err := newRecordReader(io.NewSectionReader(file, pos.Offset, math.MaxInt64-pos.Offset)).next()
 	if err != nil {
 		return nil, err
 	}
-	recLines := make([]string, 0, 5)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-		recLines = append(recLines, line)
-		if len(recLines) == 5 {
-			break
-		}
-	}
 	var b bytes.Buffer
 	rec := parseLines(recLines, &b)
 	if b.Len() != 0 {
@@ -111,25 +382,50 @@ func readRecord(fm map[string]*os.File, pos Position) (*RecordInFile, error) {
 	return &RecordInFile{Record: *rec, FileName: pos.FileName}, nil
 }
 
-// 用于查询医闹记录的函数，m保存从哈希值低8位到位置的索引，fm保存若干打开的文件，hash为哈希值，
-// filter是对获得的记录进行过滤的函数（返回true时才保留记录）
-func query(m PositionMap, fm map[string]*os.File, hash [sha256.Size]byte, filter func(*RecordInFile) bool) ([]*RecordInFile, error) {
-	res := make([]*RecordInFile, 0, 10)
+// 用于查询医闹记录的函数，m保存从哈希值低8位到位置的索引，hash为哈希值，
+// filter是对获得的记录进行过滤的函数（返回true时才保留记录）。太旧的记录会被丢弃，置信参数会按db.Decay衰减。
+// 调用者必须持有读锁
+func (db *DB) query(m PositionMap, hash [sha256.Size]byte, filter func(*RecordInFile) bool) ([]*RecordInFile, error) {
 	var buf [8]byte
 	copy(buf[:], hash[:8])
-	posList, ok := m[buf]
-	if !ok {
+	return db.queryPositions(m[buf], filter)
+}
+
+// 读取posList中的各条记录，filter、衰减和排序都与query相同。调用者必须持有读锁
+func (db *DB) queryPositions(posList []Position, filter func(*RecordInFile) bool) ([]*RecordInFile, error) {
+	if db.closed {
+		return nil, fmt.Errorf("数据库已经关闭")
+	}
+	if len(posList) == 0 {
 		return nil, nil
 	}
+	now := time.Now()
+	if db.Decay != nil {
+		now = db.Decay.now()
+	}
+	res := make([]*RecordInFile, 0, 10)
+	checked := make(map[string]bool)
 	for _, pos := range posList {
-		rec, err := readRecord(fm, pos)
+		if !checked[pos.FileName] {
+			if err := db.checkFile(pos.FileName); err != nil {
+				return nil, err
+			}
+			checked[pos.FileName] = true
+		}
+		rec, err := db.readRecord(pos)
 		if err != nil {
 			return nil, err
 		}
 		rec.FileName = pos.FileName
-		if filter(rec) {
-			res = append(res, rec)
+		if !filter(rec) || db.Decay.Expired(&rec.Record) {
+			continue
 		}
+		rec.AgeDays = -1
+		if age, ok := rec.Age(now); ok {
+			rec.AgeDays = ageDays(age)
+		}
+		rec.Confidence = db.Decay.Confidence(&rec.Record)
+		res = append(res, rec)
 	}
 	sort.Slice(res, func(i, j int) bool {
 		return res[i].Confidence < res[j].Confidence
@@ -139,14 +435,145 @@ func query(m PositionMap, fm map[string]*os.File, hash [sha256.Size]byte, filter
 
 // 给定基本信息的哈希，查询医闹记录
 func (db *DB) QueryBaseInfo(hash [sha256.Size]byte) ([]*RecordInFile, error) {
-	return query(db.BaseInfoMap, db.FileMap, hash, func(rec *RecordInFile) bool {
-		return bytes.Equal(rec.BaseInfoHash[:], hash[:]) //哈希的所有32个字节都必须相等
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.query(db.BaseInfoMap, hash, func(rec *RecordInFile) bool {
+		//哈希的所有32个字节都必须相等，已被撤回的记录不会被返回
+		return bytes.Equal(rec.BaseInfoHash[:], hash[:]) && !db.tombs.retracts(&rec.Record)
 	})
 }
 
 // 给定身份证的哈希，查询医闹记录
 func (db *DB) QueryID(hash [sha256.Size]byte) ([]*RecordInFile, error) {
-	return query(db.IDMap, db.FileMap, hash, func(rec *RecordInFile) bool {
-		return bytes.Equal(rec.IDHash[:], hash[:]) //哈希的所有32个字节都必须相等
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.query(db.IDMap, hash, func(rec *RecordInFile) bool {
+		return bytes.Equal(rec.IDHash[:], hash[:]) && !db.tombs.retracts(&rec.Record)
 	})
 }
+
+// 按哈希值的前缀查询记录，keys是m中已排序的各个键。调用者必须持有读锁
+func (db *DB) queryPrefix(m PositionMap, keys [][8]byte, prefix string) ([]*RecordInFile, error) {
+	lo, hi := prefixRange(prefix)
+	i := sort.Search(len(keys), func(i int) bool {
+		return bytes.Compare(keys[i][:], lo[:]) >= 0
+	})
+	var posList []Position
+	for ; i < len(keys) && bytes.Compare(keys[i][:], hi[:]) <= 0; i++ {
+		posList = append(posList, m[keys[i]]...)
+	}
+	return db.queryPositions(posList, func(rec *RecordInFile) bool {
+		return !db.tombs.retracts(&rec.Record)
+	})
+}
+
+// 按BaseInfoHash的前缀（十六进制）查询医闹记录，返回哈希值以此开头的所有记录，由调用者比较完整的哈希值。
+// 查询服务用它提供k-匿名的查询：服务器只能得知前缀，无法得知查询的是哪一位患者
+func (db *DB) QueryBaseInfoPrefix(prefix string) ([]*RecordInFile, error) {
+	if err := CheckHashPrefix(prefix); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.queryPrefix(db.BaseInfoMap, db.keys[0], prefix)
+}
+
+// 按IDHash的前缀（十六进制）查询医闹记录，与QueryBaseInfoPrefix相同
+func (db *DB) QueryIDPrefix(prefix string) ([]*RecordInFile, error) {
+	if err := CheckHashPrefix(prefix); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.queryPrefix(db.IDMap, db.keys[1], prefix)
+}
+
+// 按基本信息的明文进行查询，为了避免出生年份不精确，还会对年份进行加一和减一之后再进行两轮查询。
+// 输入会先被规范化；如果载入了没有规范化的旧文件，还会用输入的原文进行查询。
+// 查询到的记录中如果有加密的描述，会用基本信息将其解密
+func (db *DB) SearchBaseInfo(info string) ([]*RecordInFile, error) {
+	if err := CheckBaseInfo(info); err != nil {
+		return nil, err
+	}
+	hashers, versions := db.getHashers()
+	res := make([]*RecordInFile, 0, 10)
+	for _, s := range BaseInfoVariants(versions, info) {
+		for _, h := range hashers {
+			recList, err := db.QueryBaseInfo(h.Sum(s))
+			if err != nil {
+				return nil, err
+			}
+			for _, rec := range recList {
+				rec.BaseInfo = s
+				rec.Decrypt(h)
+			}
+			res = append(res, recList...)
+		}
+	}
+	return res, nil
+}
+
+// 按身份证号的明文进行查询，输入会先被规范化；如果载入了没有规范化的旧文件，还会用输入的原文进行查询。
+// 查询到的记录中如果有加密的描述，会用身份证号将其解密
+func (db *DB) SearchID(id string) ([]*RecordInFile, error) {
+	if err := CheckID(id); err != nil {
+		return nil, err
+	}
+	hashers, versions := db.getHashers()
+	res := make([]*RecordInFile, 0, 10)
+	for _, s := range IDVariants(versions, id) {
+		for _, h := range hashers {
+			recList, err := db.QueryID(h.Sum(s))
+			if err != nil {
+				return nil, err
+			}
+			for _, rec := range recList {
+				rec.ID = s
+				rec.Decrypt(h)
+			}
+			res = append(res, recList...)
+		}
+	}
+	return res, nil
+}
+
+// 只知道身份证号和姓名时，除了按身份证号查询之外，还用身份证号中的性别和出生年份生成基本信息，按基本信息进行查询。
+// 同时被两种方式查询到的记录只返回一次
+func (db *DB) SearchIDWithName(id, name string) ([]*RecordInFile, error) {
+	info, err := BaseInfoFromID(name, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.SearchID(id)
+	if err != nil {
+		return nil, err
+	}
+	byInfo, err := db.SearchBaseInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	return appendUnique(res, byInfo), nil
+}
+
+// 将recList中的记录追加到res中，同一个文件中的同一条记录只保留一条，并合并两者查询时匹配的明文
+func appendUnique(res, recList []*RecordInFile) []*RecordInFile {
+	for _, rec := range recList {
+		found := false
+		for _, other := range res {
+			if other.FileName == rec.FileName && other.IsSame(rec.Record) && other.Crc32 == rec.Crc32 {
+				if len(other.BaseInfo) == 0 {
+					other.BaseInfo = rec.BaseInfo
+				}
+				if len(other.ID) == 0 {
+					other.ID = rec.ID
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, rec)
+		}
+	}
+	return res
+}
@@ -2,9 +2,11 @@ package db
 
 import (
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,9 +35,9 @@ func TestQuery(t *testing.T) {
 		}
 	}
 
-	idList := []string{"11010920190401911X",
-		"11010920190401811X",
-		"11010920180401911X",
+	idList := []string{"11010920190401961X",
+		"11010919990401881X",
+		"11010920180401984X",
 	}
 	for _, id := range idList {
 		h := sha256.Sum256([]byte(id))
@@ -48,3 +50,183 @@ func TestQuery(t *testing.T) {
 	os.RemoveAll("./A.yinao.txt")
 	os.RemoveAll("./B.yinao.txt")
 }
+
+func TestSearch(t *testing.T) {
+	convertAndWriteToFile(File1+"\n"+File4, "./A.yinao.txt")
+	convertAndWriteToFile(File2+"\n"+File3, "./B.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt", "./B.yinao.txt"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 9, db.Len())
+
+	recList, err := db.SearchBaseInfo("张若美，女，2019")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(recList))
+	for _, rec := range recList {
+		assert.Equal(t, "张若美，女，2018", rec.BaseInfo)
+		assert.Equal(t, "", rec.ID)
+	}
+
+	// 输入会先被规范化
+	recList, err = db.SearchBaseInfo(" 張若美,女，２０１９")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(recList))
+
+	_, err = db.SearchBaseInfo("张若美，女2019")
+	assert.NotEqual(t, nil, err)
+
+	recList, err = db.SearchID("11010920190401961X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(recList))
+	for _, rec := range recList {
+		assert.Equal(t, "11010920190401961X", rec.ID)
+	}
+
+	recList, err = db.SearchID("NA")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(recList))
+
+	db.Close()
+	os.RemoveAll("./A.yinao.txt")
+	os.RemoveAll("./B.yinao.txt")
+}
+
+func TestQueryPrefix(t *testing.T) {
+	convertAndWriteToFile(File1+"\n"+File4, "./A.yinao.txt")
+	convertAndWriteToFile(File2+"\n"+File3, "./B.yinao.txt")
+	defer os.RemoveAll("./A.yinao.txt")
+	defer os.RemoveAll("./B.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt", "./B.yinao.txt"})
+	assert.Equal(t, nil, err)
+	defer db.Close()
+
+	h := SHA256Hasher.Sum("张若美，女，2018")
+	expected, err := db.QueryBaseInfo(h)
+	assert.Equal(t, nil, err)
+	full := hex.EncodeToString(h[:])
+	for _, n := range []int{16, 8, MinPrefixLength} {
+		recList, err := db.QueryBaseInfoPrefix(strings.ToUpper(full[:n]))
+		assert.Equal(t, nil, err)
+		assert.True(t, len(recList) >= len(expected))
+		matched := 0
+		for _, rec := range recList {
+			assert.True(t, strings.HasPrefix(hex.EncodeToString(rec.BaseInfoHash[:]), full[:n]))
+			if rec.BaseInfoHash == h {
+				matched++
+			}
+		}
+		assert.Equal(t, len(expected), matched)
+	}
+	// 按身份证号的前缀查询，结果中包括按完整的哈希值查询到的记录
+	for _, id := range []string{"11010920190401961X", "11010920180401984X", "11010919990401881X"} {
+		h := SHA256Hasher.Sum(id)
+		expected, err := db.QueryID(h)
+		assert.Equal(t, nil, err)
+		recList, err := db.QueryIDPrefix(hex.EncodeToString(h[:])[:MinPrefixLength])
+		assert.Equal(t, nil, err)
+		assert.Equal(t, len(expected), len(recList))
+	}
+
+	for _, prefix := range []string{"", "a", full[:MinPrefixLength-1], "xyzxyz", full + "00"} {
+		_, err = db.QueryBaseInfoPrefix(prefix)
+		assert.NotEqual(t, nil, err)
+	}
+}
+
+func recordsToString(recList []*RecordInFile) string {
+	var b strings.Builder
+	for _, rec := range recList {
+		b.WriteString(strings.Join(rec.ToLines(), "\n"))
+	}
+	return b.String()
+}
+
+// 多个goroutine同时查询同一个数据库，用go test -race运行时可以发现数据竞争
+func TestConcurrentQueries(t *testing.T) {
+	convertAndWriteToFile(File1+"\n"+File4, "./A.yinao.txt")
+	convertAndWriteToFile(File2+"\n"+File3, "./B.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt", "./B.yinao.txt"})
+	assert.Equal(t, nil, err)
+
+	expected := make(map[string]string)
+	for _, id := range []string{"11010920190401961X", "11010920180401984X"} {
+		recList, err := db.SearchID(id)
+		assert.Equal(t, nil, err)
+		assert.NotEqual(t, 0, len(recList))
+		expected[id] = recordsToString(recList)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for id, exp := range expected {
+					recList, err := db.SearchID(id)
+					assert.Equal(t, nil, err)
+					assert.Equal(t, exp, recordsToString(recList))
+				}
+				_, err := db.SearchBaseInfo("张若美，女，2018")
+				assert.Equal(t, nil, err)
+				assert.Equal(t, 9, db.Len())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	db.Close()
+	_, err = db.SearchID("11010920190401961X")
+	assert.Contains(t, err.Error(), "已经关闭")
+	os.RemoveAll("./A.yinao.txt")
+	os.RemoveAll("./B.yinao.txt")
+}
+
+func TestReload(t *testing.T) {
+	convertAndWriteToFile(File1, "./A.yinao.txt")
+	defer os.RemoveAll("./A.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	assert.Equal(t, nil, err)
+	defer db.Close()
+	n := db.Len()
+	reloaded, err := db.Reload()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(reloaded))
+
+	// 用新文件替换旧文件，重新载入之后查询到新的记录
+	convertAndWriteToFile(File1+"\n"+File4, "./A.tmp")
+	err = os.Rename("./A.tmp", "./A.yinao.txt")
+	assert.Equal(t, nil, err)
+	_, err = db.SearchID("11010920190401961X")
+	assert.Equal(t, nil, err)
+	reloaded, err = db.Reload()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"./A.yinao.txt"}, reloaded)
+	assert.True(t, db.Len() > n)
+	fresh, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	assert.Equal(t, nil, err)
+	for _, id := range []string{"11010920190401961X", "11010920180401984X"} {
+		expected, err := fresh.SearchID(id)
+		assert.Equal(t, nil, err)
+		recList, err := db.SearchID(id)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, recordsToString(expected), recordsToString(recList))
+	}
+	fresh.Close()
+
+	// 原地修改文件之后，重新载入之前的查询会报错
+	convertAndWriteToFile(File1, "./A.yinao.txt")
+	_, err = db.SearchID("11010920190401961X")
+	assert.Contains(t, err.Error(), "需要重新载入")
+	reloaded, err = db.Reload()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(reloaded))
+	assert.Equal(t, n, db.Len())
+	_, err = db.SearchID("11010920190401961X")
+	assert.Equal(t, nil, err)
+
+	// 文件被删除时保留旧的索引
+	os.RemoveAll("./A.yinao.txt")
+	_, err = db.Reload()
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, n, db.Len())
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	DateLayout = "2006-01-02" // 记录中日期的格式
+	day        = 24 * time.Hour
+)
+
+// 解析日期，月份和日子可以只写一位数字，例如2020-5-1
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-1-2", strings.TrimSpace(s), time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("日期 %s 格式错误，必须形如2020-05-01", s)
+	}
+	return t, nil
+}
+
+// 只保留日期部分，零值保持不变
+func truncateToDate(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// 原始记录中表示日期的行，格式为“日期：2020-05-01”，冒号可以是中文或英文的
+func cutDatePrefix(line string) (string, bool) {
+	for _, prefix := range []string{"日期：", "日期:"} {
+		if strings.HasPrefix(line, prefix) {
+			return line[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// 记录的年龄，以医闹事件的日期为准，没有事件日期时以发布日期为准，两者都没有时返回false
+func (rec *Record) Age(now time.Time) (time.Duration, bool) {
+	t := rec.IncidentDate
+	if t.IsZero() {
+		t = rec.PublishDate
+	}
+	if t.IsZero() {
+		return 0, false
+	}
+	age := truncateToDate(now).Sub(t)
+	if age < 0 {
+		age = 0
+	}
+	return age, true
+}
+
+// 置信参数随时间衰减的策略，没有日期的记录不会衰减，也不会被丢弃
+type DecayPolicy struct {
+	HalfLife time.Duration // 置信参数减半所需的时间，为0时不衰减
+	MaxAge   time.Duration // 超过这个年龄的记录会被丢弃，为0时不丢弃
+	Now      time.Time     // 计算年龄时所用的当前时间，零值表示使用time.Now()
+}
+
+// 按天数创建衰减策略，halfLifeDays和maxAgeDays为0时分别表示不衰减和不丢弃
+func NewDecayPolicy(halfLifeDays, maxAgeDays int) *DecayPolicy {
+	return &DecayPolicy{
+		HalfLife: time.Duration(halfLifeDays) * day,
+		MaxAge:   time.Duration(maxAgeDays) * day,
+	}
+}
+
+func (p *DecayPolicy) now() time.Time {
+	if p.Now.IsZero() {
+		return time.Now()
+	}
+	return p.Now
+}
+
+// 记录是否因为太旧而应该被丢弃
+func (p *DecayPolicy) Expired(rec *Record) bool {
+	if p == nil || p.MaxAge == 0 {
+		return false
+	}
+	age, ok := rec.Age(p.now())
+	return ok && age > p.MaxAge
+}
+
+// 记录的置信参数按年龄衰减之后的值
+func (p *DecayPolicy) Confidence(rec *Record) float32 {
+	if p == nil || p.HalfLife == 0 {
+		return rec.Confidence
+	}
+	age, ok := rec.Age(p.now())
+	if !ok {
+		return rec.Confidence
+	}
+	return rec.Confidence * float32(math.Exp2(-float64(age)/float64(p.HalfLife)))
+}
+
+// 年龄的天数，供显示使用
+func ageDays(age time.Duration) int {
+	return int(age / day)
+}
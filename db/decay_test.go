@@ -0,0 +1,110 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var datedRawTxt = `
+张若虚，男，2019
+11010920190401961X
+80.0
+日期：2020-5-1
+春江潮水连海平，海上明月共潮生。
+
+张若美，女，2018
+11010920180401984X
+60.0
+江流宛转绕芳甸，月照花林皆似霰。`
+
+func TestParseDate(t *testing.T) {
+	d, err := ParseDate("2020-5-1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "2020-05-01", d.Format(DateLayout))
+	_, err = ParseDate("2020/05/01")
+	assert.Contains(t, err.Error(), "格式错误")
+	_, err = parseRawLines([]string{"张若虚，男，2019", "NA", "80.0", "日期:2020-05-01"}, nil)
+	assert.Contains(t, err.Error(), "没有描述")
+	_, err = parseRawLines([]string{"张若虚，男，2019", "NA", "80.0", "日期：2020-13-01", "abc"}, nil)
+	assert.Contains(t, err.Error(), "格式错误")
+}
+
+func TestDatedRecords(t *testing.T) {
+	priv, _ := GenerateSigningKey()
+	err := ioutil.WriteFile("./in.txt", []byte(datedRawTxt), 0644)
+	assert.Equal(t, nil, err)
+	published := time.Date(2020, 6, 1, 15, 4, 5, 0, time.UTC)
+	opts := &ConvertOptions{SigningKey: priv, PublishDate: published}
+	recList, err := ExtractRecordsFromRawFileWithOptions("./in.txt", opts)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(recList))
+	assert.Equal(t, "春江潮水连海平，海上明月共潮生。", recList[0].Description)
+	assert.Equal(t, "2020-05-01", recList[0].IncidentDate.Format(DateLayout))
+	assert.True(t, recList[1].IncidentDate.IsZero())
+	lines := recList[0].ToLines()
+	assert.Equal(t, []string{"date: 2020-05-01", "published: 2020-06-01"}, lines[5:7])
+
+	var errLog bytes.Buffer
+	assert.Equal(t, recList[0], parseLines(lines, &errLog))
+	assert.Equal(t, "", errLog.String())
+	// 日期也被签名了，不能被篡改
+	lines[5] = "date: 2021-05-01"
+	assert.Nil(t, parseLines(lines, &errLog))
+	assert.Contains(t, errLog.String(), "签名错误")
+
+	// 事件日期为2020-05-01，发布日期为2020-06-01，半衰期为30天
+	policy := &DecayPolicy{HalfLife: 30 * day, Now: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)}
+	assert.InDelta(t, 80.0*0.25, policy.Confidence(recList[0]), 0.5)
+	assert.InDelta(t, 60.0*0.5, policy.Confidence(recList[1]), 0.01)
+	policy.MaxAge = 40 * day
+	assert.True(t, policy.Expired(recList[0]))
+	assert.False(t, policy.Expired(recList[1]))
+	undated := NewRecord("张三，男，2000", "NA", 50, "abc")
+	assert.Equal(t, float32(50), policy.Confidence(undated))
+	assert.False(t, policy.Expired(undated))
+
+	// 合并时只丢弃太旧的记录，不衰减置信参数
+	records := NewRecords()
+	records.Decay = policy
+	for _, rec := range append(recList, undated) {
+		records.Add(*rec, 0)
+	}
+	assert.Equal(t, 2, records.Len())
+	assert.Equal(t, 1, records.Expired())
+	var b bytes.Buffer
+	err = WriteRecordsToFileWithHeader(opts.Header(), append(recList, undated), &b)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile("./dated.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+
+	// 查询时衰减置信参数，并且给出记录的年龄
+	db, err := NewDBFromFiles([]string{"./dated.yinao.txt"})
+	assert.Equal(t, nil, err)
+	res, err := db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, float32(60), res[0].Confidence)
+	db.Decay = &DecayPolicy{HalfLife: 30 * day, MaxAge: 40 * day, Now: policy.Now}
+	res, err = db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, 30, res[0].AgeDays)
+	assert.InDelta(t, 30.0, res[0].Confidence, 0.01)
+	lines = res[0].ToLines()
+	assert.Equal(t, "======= 日期：发布于2020-06-01，距今30天", lines[6])
+	res, err = db.SearchID("11010920190401961X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(res))
+	res, err = db.SearchBaseInfo("张三，男，2000")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, -1, res[0].AgeDays)
+	assert.Nil(t, res[0].ToJSON().AgeDays)
+	db.Close()
+
+	os.RemoveAll("./in.txt")
+	os.RemoveAll("./dated.yinao.txt")
+}
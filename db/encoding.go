@@ -0,0 +1,112 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// 原始记录文件和名单文件可以使用的编码，EncodingAuto表示自动识别
+const (
+	EncodingAuto    = "auto"
+	EncodingUTF8    = "utf-8"
+	EncodingGB18030 = "gb18030"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// 将编码的名称统一为上面的几个常量之一，GBK和GB2312都按GB18030处理，因为GB18030兼容它们
+func parseEncoding(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", EncodingAuto:
+		return EncodingAuto, nil
+	case EncodingUTF8, "utf8":
+		return EncodingUTF8, nil
+	case EncodingGB18030, "gbk", "gb2312", "cp936":
+		return EncodingGB18030, nil
+	case EncodingUTF16LE, "utf16le", "utf-16", "utf16", "unicode":
+		return EncodingUTF16LE, nil
+	case EncodingUTF16BE, "utf16be":
+		return EncodingUTF16BE, nil
+	}
+	return "", fmt.Errorf("不支持的编码：%s，可以使用auto、utf-8、gbk、gb18030、utf-16le、utf-16be", name)
+}
+
+// 识别data的编码：先看文件开头的BOM，再看是否含有UTF-16中常见的0字节，
+// 最后如果不是合法的UTF-8，就认为是Windows中文版默认使用的GBK（按GB18030解码）
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+	if bytes.IndexByte(data, 0) >= 0 { //文本中的ASCII字符在UTF-16中有一个字节是0
+		even, odd := 0, 0
+		for i, c := range data {
+			if c != 0 {
+				continue
+			}
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+		if odd >= even {
+			return EncodingUTF16LE
+		}
+		return EncodingUTF16BE
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	return EncodingGB18030
+}
+
+// 将编码为enc（为空或者auto时自动识别）的data转为UTF-8文本，开头的BOM会被去掉。返回转换后的文本和实际使用的编码
+func DecodeText(data []byte, enc string) ([]byte, string, error) {
+	enc, err := parseEncoding(enc)
+	if err != nil {
+		return nil, "", err
+	}
+	if enc == EncodingAuto {
+		enc = detectEncoding(data)
+	}
+	var decoder *encoding.Decoder
+	switch enc {
+	case EncodingUTF8:
+		data = bytes.TrimPrefix(data, bomUTF8)
+		if !utf8.Valid(data) {
+			return nil, enc, fmt.Errorf("文本不是合法的UTF-8编码")
+		}
+		return data, enc, nil
+	case EncodingGB18030:
+		decoder = simplifiedchinese.GB18030.NewDecoder()
+	case EncodingUTF16LE:
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+	case EncodingUTF16BE:
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder()
+	}
+	res, err := decoder.Bytes(data)
+	if err != nil {
+		return nil, enc, fmt.Errorf("无法按%s编码读取文本：%s", enc, err.Error())
+	}
+	if bytes.ContainsRune(res, utf8.RuneError) { //解码器遇到非法的字节时，会用U+FFFD代替
+		return nil, enc, fmt.Errorf("文本不是合法的%s编码", enc)
+	}
+	return res, enc, nil
+}
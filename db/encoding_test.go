@@ -0,0 +1,74 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDecodeText(t *testing.T) {
+	const text = "张若虚，男，2019\r\n11010920190401961X\r\n"
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String(text)
+	utf16le, _ := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().String(text)
+	utf16be, _ := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().String(text)
+	cases := []struct {
+		data string
+		enc  string
+	}{
+		{text, EncodingUTF8},
+		{"\xef\xbb\xbf" + text, EncodingUTF8},
+		{gbk, EncodingGB18030},
+		{"\xff\xfe" + utf16le, EncodingUTF16LE},
+		{"\xfe\xff" + utf16be, EncodingUTF16BE},
+		{utf16le, EncodingUTF16LE}, //没有BOM时按0字节的位置识别
+		{utf16be, EncodingUTF16BE},
+	}
+	for _, c := range cases {
+		res, enc, err := DecodeText([]byte(c.data), EncodingAuto)
+		assert.Nil(t, err)
+		assert.Equal(t, c.enc, enc)
+		assert.Equal(t, text, string(res))
+	}
+
+	// 指定编码时不再自动识别
+	res, enc, err := DecodeText([]byte(gbk), "GBK")
+	assert.Nil(t, err)
+	assert.Equal(t, EncodingGB18030, enc)
+	assert.Equal(t, text, string(res))
+	_, _, err = DecodeText([]byte(gbk), "utf-8")
+	assert.NotNil(t, err)
+	_, _, err = DecodeText([]byte(text), "big5")
+	assert.NotNil(t, err)
+	_, _, err = DecodeText([]byte{0xb0, 0xa1, 0xff}, EncodingAuto)
+	assert.NotNil(t, err)
+}
+
+func TestExtractRecordsFromEncodedFile(t *testing.T) {
+	err := ioutil.WriteFile("./dat.txt", []byte(File1), 0644)
+	assert.Nil(t, err)
+	expected, err := ExtractRecordsFromRawFile("./dat.txt")
+	assert.Nil(t, err)
+
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String(File1)
+	assert.Nil(t, err)
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(File1)
+	assert.Nil(t, err)
+	for _, data := range []string{gbk, utf16} {
+		err = ioutil.WriteFile("./dat.txt", []byte(data), 0644)
+		assert.Nil(t, err)
+		recList, err := ExtractRecordsFromRawFile("./dat.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, recList)
+	}
+
+	// 按错误的编码读取时报错，而不是对乱码计算哈希值
+	err = ioutil.WriteFile("./dat.txt", []byte(gbk), 0644)
+	assert.Nil(t, err)
+	_, err = ExtractRecordsFromRawFileWithOptions("./dat.txt", &ConvertOptions{Encoding: EncodingUTF8})
+	assert.NotNil(t, err)
+	os.Remove("./dat.txt")
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	SchemeSHA256     = "sha256"      // 默认的哈希方案：直接计算明文的sha256
+	SchemeHMACSHA256 = "hmac-sha256" // 带密钥的哈希方案：以群组密钥为键计算明文的HMAC-SHA256
+	SchemeArgon2id   = "argon2id"    // 消耗大量内存的哈希方案：使用固定的公开盐值计算明文的Argon2id
+)
+
+const (
+	DefaultArgon2Time    = 1         // Argon2id默认的迭代次数
+	DefaultArgon2Memory  = 64 * 1024 // Argon2id默认使用的内存大小，单位为KiB
+	DefaultArgon2Threads = 4         // Argon2id默认的并行度
+
+	maxArgon2Time   = 64
+	maxArgon2Memory = 4 * 1024 * 1024
+)
+
+// Argon2id使用的盐值。它是公开且固定的，这样不同的人对同一明文才能得到相同的哈希值
+var argon2Salt = []byte("YinaoBlacklist argon2id salt")
+
+// 计算身份信息（基本信息或者身份证号）的哈希值的方法
+type Hasher interface {
+	// 哈希方案的描述，它会被写入加密记录文件的头部，描述相同的哈希方法得到的哈希值才能相互匹配
+	Scheme() string
+	// 计算哈希值
+	Sum(data string) [sha256.Size]byte
+}
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Scheme() string {
+	return SchemeSHA256
+}
+
+func (sha256Hasher) Sum(data string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(data))
+}
+
+// 默认的哈希方法，不需要任何密钥
+var SHA256Hasher Hasher = sha256Hasher{}
+
+type hmacHasher struct {
+	secret []byte
+	scheme string
+}
+
+// 创建以群组密钥为键的HMAC-SHA256哈希方法。不知道群组密钥的人，无法通过枚举姓名和出生年份来反推哈希值对应的患者。
+// 为了避免把用不同密钥生成的记录混在一起，哈希方案的描述中包含了密钥的指纹
+func NewHMACHasher(secret []byte) Hasher {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("YinaoBlacklist key fingerprint"))
+	return &hmacHasher{
+		secret: secret,
+		scheme: fmt.Sprintf("%s/%x", SchemeHMACSHA256, mac.Sum(nil)[:4]),
+	}
+}
+
+func (h *hmacHasher) Scheme() string {
+	return h.scheme
+}
+
+func (h *hmacHasher) Sum(data string) (res [sha256.Size]byte) {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(data))
+	copy(res[:], mac.Sum(nil))
+	return
+}
+
+type argon2Hasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// 创建Argon2id哈希方法，time是迭代次数，memory是使用的内存大小（单位为KiB），threads是并行度。
+// 计算一次哈希值需要消耗大量的内存和时间，使得用GPU枚举身份证号或者姓名的代价变得非常高昂。
+// 这些参数会被记录在哈希方案的描述中，查询时会使用相同的参数
+func NewArgon2Hasher(time, memory uint32, threads uint8) (Hasher, error) {
+	if time < 1 || time > maxArgon2Time {
+		return nil, fmt.Errorf("Argon2id的迭代次数必须在1～%d之间：%d", maxArgon2Time, time)
+	}
+	if threads < 1 {
+		return nil, fmt.Errorf("Argon2id的并行度必须大于0")
+	}
+	if memory < 8*uint32(threads) || memory > maxArgon2Memory {
+		return nil, fmt.Errorf("Argon2id使用的内存必须在%dKiB～%dKiB之间：%d", 8*uint32(threads), maxArgon2Memory, memory)
+	}
+	return &argon2Hasher{time: time, memory: memory, threads: threads}, nil
+}
+
+func (h *argon2Hasher) Scheme() string {
+	return fmt.Sprintf("%s/t=%d,m=%d,p=%d", SchemeArgon2id, h.time, h.memory, h.threads)
+}
+
+func (h *argon2Hasher) Sum(data string) (res [sha256.Size]byte) {
+	copy(res[:], argon2.IDKey([]byte(data), argon2Salt, h.time, h.memory, h.threads, sha256.Size))
+	return
+}
+
+// 解析Argon2id哈希方案的描述，例如"argon2id/t=1,m=65536,p=4"
+func parseArgon2Scheme(scheme string) (Hasher, error) {
+	var time, memory uint32
+	var threads uint8
+	_, err := fmt.Sscanf(scheme, SchemeArgon2id+"/t=%d,m=%d,p=%d", &time, &memory, &threads)
+	if err != nil {
+		return nil, fmt.Errorf("哈希方案%s的参数格式错误", scheme)
+	}
+	h, err := NewArgon2Hasher(time, memory, threads)
+	if err != nil {
+		return nil, err
+	}
+	if h.Scheme() != scheme { //参数的写法必须是规范的，否则相同的参数会有不同的描述
+		return nil, fmt.Errorf("哈希方案%s的参数格式错误", scheme)
+	}
+	return h, nil
+}
+
+// 根据文件头部所记录的哈希方案，创建对应的哈希方法，secret是群组密钥，不使用带密钥的哈希方案时可以为nil
+func ParseHasher(scheme string, secret []byte) (Hasher, error) {
+	name := strings.SplitN(scheme, "/", 2)[0]
+	switch name {
+	case SchemeSHA256:
+		if scheme != SchemeSHA256 {
+			break
+		}
+		return SHA256Hasher, nil
+	case SchemeHMACSHA256:
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("哈希方案%s需要提供群组密钥", scheme)
+		}
+		h := NewHMACHasher(secret)
+		if h.Scheme() != scheme {
+			return nil, fmt.Errorf("群组密钥与哈希方案%s不匹配，请检查密钥是否正确", scheme)
+		}
+		return h, nil
+	case SchemeArgon2id:
+		return parseArgon2Scheme(scheme)
+	}
+	return nil, fmt.Errorf("不支持的哈希方案：%s", scheme)
+}
+
+const (
+	// 按哈希值的前缀查询时，前缀最少的十六进制位数。5位时要取得所有记录需要约一百万次查询，
+	// 而每个前缀仍然对应上千个可能的患者，足以让服务器无法得知查询的是谁
+	MinPrefixLength = 5
+	MaxPrefixLength = 16 // 前缀最多的十六进制位数，即索引中键的全部8个字节
+)
+
+// 检查哈希值的前缀，它必须是十六进制数，长度在MinPrefixLength和MaxPrefixLength之间
+func CheckHashPrefix(prefix string) error {
+	if len(prefix) < MinPrefixLength || len(prefix) > MaxPrefixLength {
+		return fmt.Errorf("哈希值前缀的长度必须在%d到%d位之间：%s", MinPrefixLength, MaxPrefixLength, prefix)
+	}
+	if _, err := hex.DecodeString(strings.Repeat("0", len(prefix)%2) + prefix); err != nil {
+		return fmt.Errorf("哈希值前缀必须是十六进制数：%s", prefix)
+	}
+	return nil
+}
+
+// 哈希值的前缀所对应的索引中的键的范围，前缀必须已经被CheckHashPrefix检查过
+func prefixRange(prefix string) (lo, hi [8]byte) {
+	hex.Decode(lo[:], []byte(prefix+strings.Repeat("0", MaxPrefixLength-len(prefix))))
+	hex.Decode(hi[:], []byte(prefix+strings.Repeat("f", MaxPrefixLength-len(prefix))))
+	return
+}
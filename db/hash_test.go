@@ -0,0 +1,191 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHasher(t *testing.T) {
+	h, err := ParseHasher("sha256", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, SHA256Hasher, h)
+	_, err = ParseHasher("sha256/abc", nil)
+	assert.NotEqual(t, nil, err)
+	_, err = ParseHasher("md5", nil)
+	assert.NotEqual(t, nil, err)
+
+	secret := []byte("correct horse battery staple")
+	scheme := NewHMACHasher(secret).Scheme()
+	assert.True(t, strings.HasPrefix(scheme, SchemeHMACSHA256+"/"))
+	h, err = ParseHasher(scheme, secret)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, scheme, h.Scheme())
+	_, err = ParseHasher(scheme, nil)
+	assert.NotEqual(t, nil, err)
+	_, err = ParseHasher(scheme, []byte("wrong secret"))
+	assert.NotEqual(t, nil, err)
+
+	info := "张若虚，男，2019"
+	assert.Equal(t, h.Sum(info), NewHMACHasher(secret).Sum(info))
+	assert.NotEqual(t, h.Sum(info), SHA256Hasher.Sum(info))
+	assert.NotEqual(t, h.Sum(info), NewHMACHasher([]byte("wrong secret")).Sum(info))
+}
+
+// 用指定的哈希方法转换原始记录，并写入加密记录文件
+func convertWithHasher(h Hasher, inTxt string, outFile string) {
+	err := ioutil.WriteFile("./in.txt", []byte(inTxt), 0644)
+	if err != nil {
+		panic(err)
+	}
+	opts := &ConvertOptions{Hasher: h}
+	recList, err := ExtractRecordsFromRawFileWithOptions("./in.txt", opts)
+	if err != nil {
+		panic(err)
+	}
+	out, err := os.OpenFile(outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	err = WriteRecordsToFileWithHeader(opts.Header(), recList, out)
+	if err != nil {
+		panic(err)
+	}
+	os.RemoveAll("./in.txt")
+}
+
+func TestHMACScheme(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	h := NewHMACHasher(secret)
+	convertWithHasher(h, File1, "./A.yinao.txt")
+	convertWithHasher(SHA256Hasher, File2, "./B.yinao.txt")
+
+	dat, err := ioutil.ReadFile("./A.yinao.txt")
+	assert.Equal(t, nil, err)
+	assert.True(t, strings.HasPrefix(string(dat), fmt.Sprintf("%s\nversion: %d\nhash: %s\nnormalize: 1\n\n", FileMagic, FormatVersion, h.Scheme())))
+
+	_, err = NewDBFromFiles([]string{"./A.yinao.txt"})
+	assert.NotEqual(t, nil, err)
+	_, err = NewDBFromFilesWithSecret([]string{"./A.yinao.txt"}, []byte("wrong secret"))
+	assert.NotEqual(t, nil, err)
+
+	db, err := NewDBFromFilesWithSecret([]string{"./A.yinao.txt", "./B.yinao.txt"}, secret)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, h.Scheme(), db.HeaderMap["./A.yinao.txt"].Scheme)
+	assert.Equal(t, SchemeSHA256, db.HeaderMap["./B.yinao.txt"].Scheme)
+	recList, err := db.SearchBaseInfo("张若美，女，2018")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(recList))
+	recList, err = db.SearchID("11010920190401961X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+	assert.Equal(t, "./A.yinao.txt", recList[0].FileName)
+	db.Close()
+
+	os.MkdirAll("./a", os.ModePerm)
+	os.Rename("./A.yinao.txt", "./a/A.yinao.txt")
+	os.Rename("./B.yinao.txt", "./a/B.yinao.txt")
+	var errLog bytes.Buffer
+	records := NewRecordsWithScheme(h.Scheme())
+	records.AddEncRecordsInDir("./a", 0, &errLog)
+	assert.Equal(t, 2, records.Len())
+	assert.Contains(t, errLog.String(), "B.yinao.txt使用的哈希方案sha256")
+
+	var out bytes.Buffer
+	err = records.WriteToFile(&out)
+	assert.Equal(t, nil, err)
+	assert.True(t, strings.HasPrefix(out.String(), fmt.Sprintf("%s\nversion: %d\nhash: %s\nnormalize: 1\n\n", FileMagic, FormatVersion, h.Scheme())))
+
+	os.RemoveAll("./a")
+}
+
+func TestArgon2Scheme(t *testing.T) {
+	h, err := NewArgon2Hasher(1, 64, 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "argon2id/t=1,m=64,p=1", h.Scheme())
+	h2, err := ParseHasher(h.Scheme(), nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, h.Sum("11010920190401961X"), h2.Sum("11010920190401961X"))
+	assert.NotEqual(t, h.Sum("11010920190401961X"), SHA256Hasher.Sum("11010920190401961X"))
+
+	for _, scheme := range []string{
+		"argon2id",
+		"argon2id/t=1,m=64",
+		"argon2id/t=01,m=64,p=1",
+		"argon2id/t=0,m=64,p=1",
+		"argon2id/t=1,m=4,p=1",
+		"argon2id/t=1,m=64,p=0",
+	} {
+		_, err = ParseHasher(scheme, nil)
+		assert.NotEqual(t, nil, err, scheme)
+	}
+
+	convertWithHasher(h, File1, "./A.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, h.Scheme(), db.HeaderMap["./A.yinao.txt"].Scheme)
+	recList, err := db.SearchBaseInfo("张若虚，男，2020")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+	recList, err = db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+	db.Close()
+	os.RemoveAll("./A.yinao.txt")
+}
+
+func benchmarkHasher(b *testing.B, h Hasher) {
+	for i := 0; i < b.N; i++ {
+		h.Sum("11010920190401961X")
+	}
+}
+
+func BenchmarkSHA256Hasher(b *testing.B) {
+	benchmarkHasher(b, SHA256Hasher)
+}
+
+func BenchmarkHMACHasher(b *testing.B) {
+	benchmarkHasher(b, NewHMACHasher([]byte("correct horse battery staple")))
+}
+
+func BenchmarkArgon2Hasher(b *testing.B) {
+	h, _ := NewArgon2Hasher(DefaultArgon2Time, DefaultArgon2Memory, DefaultArgon2Threads)
+	benchmarkHasher(b, h)
+}
+
+// 一次按基本信息的查询需要计算三个哈希值（包括出生年份加一和减一）
+func BenchmarkSearchBaseInfoArgon2(b *testing.B) {
+	h, _ := NewArgon2Hasher(DefaultArgon2Time, DefaultArgon2Memory, DefaultArgon2Threads)
+	convertWithHasher(h, File1, "./A.yinao.txt")
+	defer os.RemoveAll("./A.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.SearchBaseInfo("张若虚，男，2019")
+	}
+}
+
+func BenchmarkSearchIDArgon2(b *testing.B) {
+	h, _ := NewArgon2Hasher(DefaultArgon2Time, DefaultArgon2Memory, DefaultArgon2Threads)
+	convertWithHasher(h, File1, "./A.yinao.txt")
+	defer os.RemoveAll("./A.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.SearchID("11010920190401961X")
+	}
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	FileMagic     = "#YinaoBlacklist" // 加密记录文件头部的第一行
+	FormatVersion = 6                 // 本程序写入的加密记录文件的格式版本，也是它能读取的最高版本
+)
+
+// 加密记录文件的头部。它位于文件的开始，是以FileMagic开头、以空行结束的一段文本，其余各行的格式都是“键: 值”。
+// 各个版本的格式：
+//  1. 没有头部，每条记录是5行文本，使用sha256哈希方案
+//  2. 有头部，头部中必须有version和hash两个字段，记录的格式与版本1相同
+//  3. 记录的5行文本之后可以有若干扩展行，格式为“键: 值”，例如贡献者的签名“sig: 公钥 签名”
+//  4. 增加了撤回记录，它带有扩展行“retract: 被撤回记录的指纹”
+//  5. 增加了医闹事件的日期“date: 2020-05-01”和记录的发布日期“published: 2020-06-01”
+//  6. 头部中增加了normalize字段，它是计算哈希值之前对基本信息和身份证号进行规范化的方法的版本，没有时为0
+type FileHeader struct {
+	Version       int    // 文件格式的版本
+	Scheme        string // 计算哈希值所使用的方案
+	Creator       string // 生成此文件的人或者程序，可以为空
+	Normalization int    // 计算哈希值之前对基本信息和身份证号进行规范化的方法的版本，见NormalizationVersion
+}
+
+// 没有头部的文件所对应的头部
+func defaultHeader() *FileHeader {
+	return &FileHeader{Version: 1, Scheme: SchemeSHA256}
+}
+
+// 若干行文本是否是文件的头部
+func isHeader(lines []string) bool {
+	return len(lines) != 0 && lines[0] == FileMagic
+}
+
+// 解析文件的头部
+func parseHeader(lines []string) (*FileHeader, error) {
+	hdr := &FileHeader{}
+	for _, line := range lines[1:] {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("文件头部的格式错误：%s", line)
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "version":
+			v, err := strconv.Atoi(value)
+			if err != nil || v < 2 {
+				return nil, fmt.Errorf("文件格式的版本错误：%s", value)
+			}
+			if v > FormatVersion {
+				return nil, fmt.Errorf("文件格式的版本%d太新了，本程序最高只能读取版本%d，请升级本程序", v, FormatVersion)
+			}
+			hdr.Version = v
+		case "hash":
+			hdr.Scheme = value
+		case "creator":
+			hdr.Creator = value
+		case "normalize":
+			v, err := strconv.Atoi(value)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("规范化方法的版本错误：%s", value)
+			}
+			if v > NormalizationVersion {
+				return nil, fmt.Errorf("规范化方法的版本%d太新了，本程序最高只能使用版本%d，请升级本程序", v, NormalizationVersion)
+			}
+			hdr.Normalization = v
+		default:
+			return nil, fmt.Errorf("文件头部中有未知的字段：%s", line)
+		}
+	}
+	if hdr.Version == 0 {
+		return nil, fmt.Errorf("文件头部中缺少version字段")
+	}
+	if len(hdr.Scheme) == 0 {
+		return nil, fmt.Errorf("文件头部中缺少hash字段")
+	}
+	if hdr.Normalization != 0 && hdr.Version < 6 {
+		return nil, fmt.Errorf("版本%d的文件头部中不能有normalize字段", hdr.Version)
+	}
+	return hdr, nil
+}
+
+// 按照文件所用的规范化方法对基本信息进行规范化，以便计算与文件中的记录相同的哈希值
+func (hdr *FileHeader) NormalizeBaseInfo(info string) string {
+	return normalizeBaseInfo(hdr.Normalization, info)
+}
+
+// 按照文件所用的规范化方法对身份证号进行规范化，以便计算与文件中的记录相同的哈希值
+func (hdr *FileHeader) NormalizeID(id string) string {
+	return normalizeID(hdr.Normalization, id)
+}
+
+// 将文件头部转为若干行纯文本，写入的总是本程序所使用的格式版本
+func (hdr *FileHeader) ToLines() []string {
+	lines := []string{
+		FileMagic,
+		fmt.Sprintf("version: %d", FormatVersion),
+		"hash: " + hdr.Scheme,
+	}
+	if hdr.Normalization != 0 {
+		lines = append(lines, fmt.Sprintf("normalize: %d", hdr.Normalization))
+	}
+	if len(hdr.Creator) != 0 {
+		lines = append(lines, "creator: "+strings.Join(strings.Fields(hdr.Creator), " "))
+	}
+	return lines
+}
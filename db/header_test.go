@@ -0,0 +1,72 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeader(t *testing.T) {
+	hdr, err := parseHeader(strings.Split("#YinaoBlacklist\nversion: 3\nhash: sha256\ncreator: 张医生", "\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, &FileHeader{Version: 3, Scheme: SchemeSHA256, Creator: "张医生"}, hdr)
+
+	for _, txt := range []string{
+		"#YinaoBlacklist\nhash: sha256",
+		"#YinaoBlacklist\nversion: 2",
+		"#YinaoBlacklist\nversion: 1\nhash: sha256",
+		"#YinaoBlacklist\nversion: two\nhash: sha256",
+		"#YinaoBlacklist\nversion: 3\nhash: sha256\ncolor: red",
+		"#YinaoBlacklist\nversion 2\nhash: sha256",
+	} {
+		_, err = parseHeader(strings.Split(txt, "\n"))
+		assert.NotEqual(t, nil, err, txt)
+	}
+	_, err = parseHeader(strings.Split(fmt.Sprintf("#YinaoBlacklist\nversion: %d\nhash: sha256", FormatVersion+1), "\n"))
+	assert.Contains(t, err.Error(), "请升级本程序")
+}
+
+func TestHeaderVersions(t *testing.T) {
+	// 没有头部的文件被当作版本1读取
+	recList, err := ExtractRecordsFromRawFile("../testdata/testconvert/origin1.txt")
+	assert.Equal(t, nil, err)
+	var b bytes.Buffer
+	for _, rec := range recList {
+		writeLines(rec.ToLines(), &b)
+	}
+	err = ioutil.WriteFile("./v1.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+
+	opts := &ConvertOptions{Creator: "张医生"}
+	b.Reset()
+	err = WriteRecordsToFileWithHeader(opts.Header(), recList, &b)
+	assert.Equal(t, nil, err)
+	assert.True(t, strings.HasPrefix(b.String(), fmt.Sprintf("#YinaoBlacklist\nversion: %d\nhash: sha256\nnormalize: 1\ncreator: 张医生\n\n", FormatVersion)))
+	err = ioutil.WriteFile("./new.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+
+	db, err := NewDBFromFiles([]string{"./v1.yinao.txt", "./new.yinao.txt"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, db.HeaderMap["./v1.yinao.txt"].Version)
+	assert.Equal(t, FormatVersion, db.HeaderMap["./new.yinao.txt"].Version)
+	assert.Equal(t, "张医生", db.HeaderMap["./new.yinao.txt"].Creator)
+	recs, err := db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(recs))
+	db.Close()
+
+	txt := fmt.Sprintf("#YinaoBlacklist\nversion: %d\nhash: sha256\n\n", FormatVersion+1)
+	err = ioutil.WriteFile("./future.yinao.txt", []byte(txt), 0644)
+	assert.Equal(t, nil, err)
+	_, err = NewDBFromFiles([]string{"./future.yinao.txt"})
+	assert.NotEqual(t, nil, err)
+
+	os.RemoveAll("./v1.yinao.txt")
+	os.RemoveAll("./new.yinao.txt")
+	os.RemoveAll("./future.yinao.txt")
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 身份证号（GB 11643-1999）前两位的省级行政区划代码
+var provinceCodes = map[string]string{
+	"11": "北京", "12": "天津", "13": "河北", "14": "山西", "15": "内蒙古",
+	"21": "辽宁", "22": "吉林", "23": "黑龙江",
+	"31": "上海", "32": "江苏", "33": "浙江", "34": "安徽", "35": "福建", "36": "江西", "37": "山东",
+	"41": "河南", "42": "湖北", "43": "湖南", "44": "广东", "45": "广西", "46": "海南",
+	"50": "重庆", "51": "四川", "52": "贵州", "53": "云南", "54": "西藏",
+	"61": "陕西", "62": "甘肃", "63": "青海", "64": "宁夏", "65": "新疆",
+	"71": "台湾", "81": "香港", "82": "澳门", "83": "台湾", // 83是台湾居民居住证使用的代码
+}
+
+// 检查身份证号前6位的行政区划代码（GB/T 2260）。省级代码必须存在；地级代码（第3～4位）为01～70，
+// 或者为90（省直辖县级行政区划）；县级代码（第5～6位）不能是00。
+// 港澳台居民居住证只有省级代码，后4位都是0。不检查具体的县是否存在，因为行政区划经常调整，旧的代码仍然有效
+func checkRegionCode(id string) error {
+	if _, ok := provinceCodes[id[:2]]; !ok {
+		return fmt.Errorf("身份证号 %s 的地区码错误，不存在以%s开头的行政区划", id, id[:2])
+	}
+	if id[0] >= '7' {
+		if id[2:6] != "0000" {
+			return fmt.Errorf("身份证号 %s 的地区码错误，%s（%s）之后的4位应当都是0", id, id[:2], provinceCodes[id[:2]])
+		}
+		return nil
+	}
+	city, _ := strconv.Atoi(id[2:4])
+	if city == 0 || (city > 70 && city != 90) {
+		return fmt.Errorf("身份证号 %s 的地区码错误，第3～4位的地级代码%s不存在", id, id[2:4])
+	}
+	if id[4:6] == "00" {
+		return fmt.Errorf("身份证号 %s 的地区码错误，第5～6位的县级代码不能是00", id)
+	}
+	return nil
+}
+
+// 身份证号前17位的加权因子
+var idWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+// 按照ISO 7064 MOD 11-2计算身份证号的校验码，body是身份证号的前17位数字
+func idCheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(body[i]-'0') * idWeights[i]
+	}
+	return "10X98765432"[sum%11]
+}
+
+// 身份证号中的出生日期
+func parseIDBirthDate(id string) (time.Time, error) {
+	return time.Parse("20060102", id[6:14])
+}
+
+// 检查身份证号的输入是否有误：长度、字符、地区码（省级代码以及地级、县级代码的范围）、出生日期和校验码，检查之前会先进行规范化
+func CheckID(id string) error {
+	id = NormalizeID(id)
+	if id == "NA" {
+		return nil
+	}
+	runes := []rune(id)
+	if len(runes) != 18 {
+		return fmt.Errorf("身份证号 %s 不是18位。", id)
+	}
+	last := len(runes) - 1
+	for _, r := range runes[:last] {
+		if '0' <= r && r <= '9' {
+			continue
+		}
+		return fmt.Errorf("身份证号 %s 格式错误，非法字符：%s", id, string(r))
+	}
+	r := runes[last]
+	if !('0' <= r && r <= '9' || 'X' == r) {
+		return fmt.Errorf("身份证号 %s 格式错误，最后一个字符必须是数字0～9或者字母X", id)
+	}
+	if err := checkRegionCode(id); err != nil {
+		return err
+	}
+	birth, err := parseIDBirthDate(id)
+	if err != nil {
+		return fmt.Errorf("身份证号 %s 中的出生日期%s不是一个合法的日期", id, id[6:14])
+	}
+	if birth.Year() < minBirthYear || birth.After(time.Now()) {
+		return fmt.Errorf("身份证号 %s 中的出生日期%s超出了合理的范围", id, id[6:14])
+	}
+	if c := idCheckDigit(id); c != id[17] {
+		return fmt.Errorf("身份证号 %s 的校验码错误，最后一位应当是%c，请检查是否输错了某一位", id, c)
+	}
+	return nil
+}
+
+// 身份证号中的性别，第17位是奇数为男，偶数为女。id必须已经通过了CheckID的检查，并且不是NA
+func IDGender(id string) string {
+	if (id[16]-'0')%2 == 1 {
+		return "男"
+	}
+	return "女"
+}
+
+// 身份证号中的出生年份。id必须已经通过了CheckID的检查，并且不是NA
+func IDBirthYear(id string) int {
+	year, _ := strconv.Atoi(id[6:10])
+	return year
+}
+
+// 检查基本信息中的性别和出生年份是否与身份证号一致，身份证号为NA时不检查。info和id必须已经通过了检查
+func CheckBaseInfoWithID(info, id string) error {
+	info, id = NormalizeBaseInfo(info), NormalizeID(id)
+	if id == "NA" {
+		return nil
+	}
+	parts := strings.Split(info, "，")
+	if gender := IDGender(id); parts[1] != gender {
+		return fmt.Errorf("基本信息 %s 与身份证号 %s 矛盾：身份证号中的性别是%s", info, id, gender)
+	}
+	if year := IDBirthYear(id); parts[2] != strconv.Itoa(year) {
+		return fmt.Errorf("基本信息 %s 与身份证号 %s 矛盾：身份证号中的出生年份是%d", info, id, year)
+	}
+	return nil
+}
+
+// 用身份证号补全基本信息中缺少的性别和出生年份。info可以只有姓名，也可以是“姓名，，”这样留空了某些项的基本信息；
+// 已经填写的项不会被修改。返回的是规范化之后的基本信息，身份证号为NA或者有误时不补全
+func FillBaseInfoFromID(info, id string) string {
+	info, id = NormalizeBaseInfo(info), NormalizeID(id)
+	if id == "NA" || CheckID(id) != nil {
+		return info
+	}
+	parts := strings.Split(info, "，")
+	if len(parts) == 1 {
+		parts = append(parts, "", "")
+	}
+	if len(parts) != 3 {
+		return info
+	}
+	if len(parts[1]) == 0 {
+		parts[1] = IDGender(id)
+	}
+	if len(parts[2]) == 0 {
+		parts[2] = strconv.Itoa(IDBirthYear(id))
+	}
+	return strings.Join(parts, "，")
+}
+
+// 用姓名和身份证号生成基本信息，以便在只知道身份证号和姓名时按基本信息进行查询
+func BaseInfoFromID(name, id string) (string, error) {
+	name, id = NormalizeBaseInfo(name), NormalizeID(id)
+	if err := CheckID(id); err != nil {
+		return "", err
+	}
+	if id == "NA" {
+		return "", fmt.Errorf("身份证号为NA时无法生成基本信息")
+	}
+	if len(name) == 0 || strings.Contains(name, "，") {
+		return "", fmt.Errorf("姓名 %s 不能为空，也不能含有中文逗号", name)
+	}
+	return FillBaseInfoFromID(name, id), nil
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseInfoFromID(t *testing.T) {
+	assert.Equal(t, "男", IDGender("11010920190401961X"))
+	assert.Equal(t, "女", IDGender("11010920180401984X"))
+	assert.Equal(t, 2018, IDBirthYear("11010920180401984X"))
+
+	assert.Equal(t, nil, CheckBaseInfoWithID("张若美，女，2018", "11010920180401984X"))
+	assert.Equal(t, nil, CheckBaseInfoWithID("张若美，女，2018", "NA"))
+	err := CheckBaseInfoWithID("张若美，男，2018", "11010920180401984X")
+	assert.Contains(t, err.Error(), "性别是女")
+	err = CheckBaseInfoWithID("张若美，女，2017", "11010920180401984X")
+	assert.Contains(t, err.Error(), "出生年份是2018")
+
+	assert.Equal(t, "张若美，女，2018", FillBaseInfoFromID("张若美", "11010920180401984X"))
+	assert.Equal(t, "张若美，女，2018", FillBaseInfoFromID("张若美，，", "11010920180401984X"))
+	assert.Equal(t, "张若美，男，2018", FillBaseInfoFromID("张若美，男，", "11010920180401984X"))
+	assert.Equal(t, "张若美", FillBaseInfoFromID("张若美", "NA"))
+
+	info, err := BaseInfoFromID(" 张若美 ", "11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "张若美，女，2018", info)
+	_, err = BaseInfoFromID("", "11010920180401984X")
+	assert.NotEqual(t, nil, err)
+	_, err = BaseInfoFromID("张若美", "NA")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestConvertWithID(t *testing.T) {
+	txt := `
+张若美，男，2018
+11010920180401984X
+98.0
+江流宛转绕芳甸，月照花林皆似霰。`
+	err := ioutil.WriteFile("./dat.txt", []byte(txt), 0644)
+	assert.Equal(t, nil, err)
+	defer os.Remove("./dat.txt")
+	_, err = ExtractRecordsFromRawFile("./dat.txt")
+	assert.Contains(t, err.Error(), "矛盾")
+
+	// 只有姓名时，用身份证号补全性别和出生年份
+	txt = `
+张若美
+11010920180401984X
+98.0
+江流宛转绕芳甸，月照花林皆似霰。`
+	err = ioutil.WriteFile("./dat.txt", []byte(txt), 0644)
+	assert.Equal(t, nil, err)
+	_, err = ExtractRecordsFromRawFile("./dat.txt")
+	assert.NotEqual(t, nil, err)
+	recList, err := ExtractRecordsFromRawFileWithOptions("./dat.txt", &ConvertOptions{FillFromID: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, SHA256Hasher.Sum("张若美，女，2018"), recList[0].BaseInfoHash)
+}
+
+func TestSearchIDWithName(t *testing.T) {
+	convertAndWriteToFile(File1+"\n"+File4, "./A.yinao.txt")
+	defer os.RemoveAll("./A.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./A.yinao.txt"})
+	assert.Equal(t, nil, err)
+	defer db.Close()
+
+	byID, err := db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	recList, err := db.SearchIDWithName("11010920180401984X", "张若美")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(byID), len(recList))
+	for _, rec := range recList {
+		assert.Equal(t, "张若美，女，2018", rec.BaseInfo)
+	}
+	_, err = db.SearchIDWithName("11010920180401984X", "")
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// 从表格导入原始记录时，表头中各列的名称，其他名称见batchColumns
+var importColumns = map[string]string{
+	"置信参数": "confidence",
+	"置信指数": "confidence",
+	"置信度":  "confidence",
+	"描述":   "description",
+	"医闹描述": "description",
+	"事件描述": "description",
+	"日期":   "date",
+	"事件日期": "date",
+	"发生日期": "date",
+}
+
+// 表格中可以导入的各列，info是“姓名，性别，出生年份”格式的基本信息，可以代替name、gender和year三列
+var importFields = []string{"info", "name", "gender", "year", "id", "confidence", "description", "date"}
+
+// 解析命令行中指定的列，格式为“name=1,gender=2,year=3,id=4,confidence=5,description=6”，
+// 等号后面可以是列号（从1开始），也可以是表头中的列名。返回的映射中，列号从0开始，列名原样保留
+func ParseColumnMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[1])) == 0 {
+			return nil, fmt.Errorf("%s 格式错误，应当是“项目=列号”或者“项目=列名”", item)
+		}
+		field, col := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if !containsString(importFields, field) {
+			return nil, fmt.Errorf("%s 不是可以导入的项目，可以导入的项目有：%s", field, strings.Join(importFields, "、"))
+		}
+		if n, err := strconv.Atoi(col); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("%s 中的列号必须从1开始", item)
+			}
+			col = "#" + strconv.Itoa(n-1)
+		}
+		mapping[field] = col
+	}
+	return mapping, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 从CSV或者TSV表格文件中读取医闹记录，见ExtractRecordsFromCSV
+func ExtractRecordsFromCSVFile(fname string, mapping map[string]string, opts *ConvertOptions) ([]*Record, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	enc := EncodingAuto
+	if opts != nil && len(opts.Encoding) != 0 {
+		enc = opts.Encoding
+	}
+	text, _, err := DecodeText(data, enc)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件%s时遇到错误：%s", fname, err.Error())
+	}
+	recList, err := ExtractRecordsFromCSV(bytes.NewReader(text), mapping, opts)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件%s时遇到错误：\n%s", fname, err.Error())
+	}
+	return recList, nil
+}
+
+// 从CSV或者TSV表格中读取医闹记录，每行一条记录，各列用英文逗号或者制表符隔开（以第一行为准）。
+// mapping指定各列的含义（见ParseColumnMapping），为nil时第一行必须是表头，按表头中的列名确定各列的含义。
+// 每一行都和原始记录文件中的记录一样进行检查，所有出错的行会和它们在表格中的行号一起报告，这时不返回任何记录
+func ExtractRecordsFromCSV(r io.Reader, mapping map[string]string, opts *ConvertOptions) ([]*Record, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	reader := csv.NewReader(strings.NewReader(text))
+	if firstLine := strings.SplitN(text, "\n", 2)[0]; strings.Contains(firstLine, "\t") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("表格格式错误：%s", err.Error())
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("表格是空的")
+	}
+	columns, hasHeader, err := resolveColumns(rows[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+	lines := csvRecordLines(text, reader.Comma)
+	if len(lines) != len(rows) { //不应当发生，万一与encoding/csv的理解不同，退而使用行的序号
+		lines = nil
+	}
+	if hasHeader {
+		rows = rows[1:]
+	}
+
+	res := make([]*Record, 0, len(rows))
+	var errs []string
+	for i, row := range rows {
+		if hasHeader {
+			i++
+		}
+		line := i + 1
+		if lines != nil {
+			line = lines[i]
+		}
+		cells := make(map[string]string)
+		empty := true
+		for field, col := range columns {
+			if col < len(row) {
+				cells[field] = strings.TrimSpace(row[col])
+				empty = empty && len(cells[field]) == 0
+			}
+		}
+		if empty {
+			continue
+		}
+		var rec *Record
+		var err error
+		switch {
+		case len(cells["confidence"]) == 0:
+			err = fmt.Errorf("没有置信参数")
+		case len(cells["description"]) == 0:
+			err = fmt.Errorf("没有描述")
+		default:
+			rec, err = parseRawLines(rawLinesFromCells(cells), opts)
+		}
+		if err != nil { //错误信息中可能带有记录的各行，合并为一行，使每一行表格只对应一行错误信息
+			errs = append(errs, fmt.Sprintf("第%d行：%s", line, strings.Replace(err.Error(), "\n", " ", -1)))
+			continue
+		}
+		res = append(res, rec)
+	}
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return res, nil
+}
+
+// 表格中的每一行从文件的第几行开始。encoding/csv会跳过空行，一个单元格中也可能有换行，
+// 所以按照与它相同的规则（双引号括起来的单元格中的换行不算作一行的结束）重新扫描一遍
+func csvRecordLines(text string, comma rune) []int {
+	var res []int
+	line := 1
+	for i := 0; i < len(text); {
+		if text[i] == '\n' || strings.HasPrefix(text[i:], "\r\n") { //空行
+			line++
+			i += strings.IndexByte(text[i:], '\n') + 1
+			continue
+		}
+		res = append(res, line)
+		fieldStart, inQuote := true, false
+		for ; i < len(text); i++ {
+			c := text[i]
+			if c == '\n' {
+				line++
+				if !inQuote {
+					i++
+					break
+				}
+			}
+			switch {
+			case inQuote && c == '"' && i+1 < len(text) && text[i+1] == '"':
+				i++
+			case inQuote && c == '"':
+				inQuote = false
+			case fieldStart && c == '"':
+				inQuote = true
+			}
+			fieldStart = rune(c) == comma
+		}
+	}
+	return res
+}
+
+// 确定表格中各项所在的列号，并判断第一行header是不是表头（含有已知的列名，或者mapping中用到了其中的列名）。
+// mapping为nil时按header中的列名确定各列，否则按mapping确定
+func resolveColumns(header []string, mapping map[string]string) (map[string]int, bool, error) {
+	for i, cell := range header {
+		header[i] = strings.TrimSpace(cell)
+	}
+	columns := make(map[string]int)
+	hasHeader := false
+	for i, cell := range header {
+		field, ok := batchColumns[cell]
+		if !ok {
+			field, ok = importColumns[cell]
+		}
+		if ok {
+			hasHeader = true
+			if mapping == nil {
+				columns[field] = i
+			}
+		}
+	}
+	for field, col := range mapping {
+		if strings.HasPrefix(col, "#") {
+			columns[field], _ = strconv.Atoi(col[1:])
+			continue
+		}
+		hasHeader = true
+		found := false
+		for i, cell := range header {
+			if cell == col {
+				columns[field], found = i, true
+				break
+			}
+		}
+		if !found {
+			return nil, false, fmt.Errorf("表头中没有名为“%s”的列", col)
+		}
+	}
+	var missing []string
+	if _, ok := columns["info"]; !ok {
+		if _, ok := columns["name"]; !ok {
+			missing = append(missing, "姓名")
+		}
+	}
+	if _, ok := columns["confidence"]; !ok {
+		missing = append(missing, "置信参数")
+	}
+	if _, ok := columns["description"]; !ok {
+		missing = append(missing, "描述")
+	}
+	if len(missing) != 0 {
+		return nil, false, fmt.Errorf("表格中缺少这些列：%s", strings.Join(missing, "、"))
+	}
+	return columns, hasHeader, nil
+}
+
+// 将表格中一行的各项转为原始记录文件中一条记录的各行，再交给parseRawLines检查和处理。
+// 没有身份证号时以NA代替，描述中的换行会被保留
+func rawLinesFromCells(cells map[string]string) []string {
+	info := cells["info"]
+	if len(info) == 0 {
+		info = cells["name"]
+		if len(cells["gender"]) != 0 || len(cells["year"]) != 0 {
+			info = strings.Join([]string{cells["name"], cells["gender"], yearOf(cells["year"])}, "，")
+		}
+	}
+	id := cells["id"]
+	if len(id) == 0 {
+		id = "NA"
+	}
+	lines := []string{info, id, cells["confidence"]}
+	if date := cells["date"]; len(date) != 0 {
+		lines = append(lines, "日期："+date)
+	}
+	for _, line := range strings.Split(strings.Replace(cells["description"], "\r", "", -1), "\n") {
+		if line = strings.TrimSpace(line); len(line) != 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 与File1内容相同的表格，描述中的换行保留在单元格中
+var csvFile1 = "姓名,性别,出生年份,身份证号,置信参数,描述\n" +
+	"张若虚,男,2019,11010920190401961X,19.0,\"春江潮水连海平，海上明月共潮生。\n滟滟随波千万里，何处春江无月明？\"\n" +
+	",,,,,\n" +
+	"张若美,女,2018-04-01,11010920180401984X,98.0,\"江流宛转绕芳甸，月照花林皆似霰。\n空里流霜不觉飞，汀上白沙看不见。\"\n"
+
+func TestExtractRecordsFromCSV(t *testing.T) {
+	err := ioutil.WriteFile("./dat.txt", []byte(File1), 0644)
+	assert.Nil(t, err)
+	expected, err := ExtractRecordsFromRawFile("./dat.txt")
+	assert.Nil(t, err)
+	os.Remove("./dat.txt")
+
+	recList, err := ExtractRecordsFromCSV(strings.NewReader(csvFile1), nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, recList)
+
+	// 用制表符隔开的表格，指定各列的含义
+	tsv := "张若虚，男，2019\t\t19.0\t春江潮水连海平，海上明月共潮生。\n"
+	recList, err = ExtractRecordsFromCSV(strings.NewReader(tsv), map[string]string{"info": "#0", "confidence": "#2", "description": "#3"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(recList))
+	assert.Equal(t, SHA256Hasher.Sum("NA"), recList[0].IDHash)
+
+	// 所有出错的行都会和行号一起报告
+	bad := "姓名,性别,出生年份,身份证号,置信参数,日期,描述\n" +
+		"张若虚,男,2019,11010920190401961X,190,,春江潮水连海平\n" +
+		"张若美,女,2018,11010920180401984X,98.0,2020-05-01,江流宛转绕芳甸\n" +
+		"张若美,男,2018,11010920180401984X,98.0,,江流宛转绕芳甸\n" +
+		"张若美,女,2018,11010920180401984X,98.0,,\n"
+	_, err = ExtractRecordsFromCSV(strings.NewReader(bad), nil, nil)
+	assert.NotNil(t, err)
+	lines := strings.Split(err.Error(), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "第2行："))
+	assert.True(t, strings.HasPrefix(lines[1], "第4行："))
+	assert.True(t, strings.HasPrefix(lines[2], "第5行："))
+
+	// 空行会被跳过，单元格中可以有换行，行号仍然是出错的行在文件中的位置
+	bad = "姓名,性别,出生年份,身份证号,置信参数,日期,描述\n\n" +
+		"张若美,女,2018,11010920180401984X,98.0,,\"江流宛转绕芳甸，\n\n月照花林皆似霰。\"\r\n" +
+		"\r\n" +
+		"张若虚,男,2019,11010920190401961X,190,,\"春江潮水\"\"连海平\"\n"
+	_, err = ExtractRecordsFromCSV(strings.NewReader(bad), nil, nil)
+	assert.NotNil(t, err)
+	lines = strings.Split(err.Error(), "\n")
+	assert.Equal(t, 1, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "第7行："), lines[0])
+
+	_, err = ExtractRecordsFromCSV(strings.NewReader("张若虚,男,2019\n"), nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := ParseColumnMapping("name=1, gender=2,year=出生日期,confidence=5,description=描述")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"name": "#0", "gender": "#1", "year": "出生日期", "confidence": "#4", "description": "描述"}, mapping)
+	_, err = ParseColumnMapping("name=0")
+	assert.NotNil(t, err)
+	_, err = ParseColumnMapping("age=1")
+	assert.NotNil(t, err)
+	_, err = ParseColumnMapping("name")
+	assert.NotNil(t, err)
+
+	// 按列名指定时，第一行是表头
+	csv := "患者,性别,出生日期,置信参数,描述\n张若虚,男,20190401,19.0,春江潮水连海平\n"
+	mapping, err = ParseColumnMapping("name=患者,gender=2,year=3,confidence=4,description=5")
+	assert.Nil(t, err)
+	recList, err := ExtractRecordsFromCSV(strings.NewReader(csv), mapping, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(recList))
+	assert.Equal(t, SHA256Hasher.Sum("张若虚，男，2019"), recList[0].BaseInfoHash)
+	_, err = ExtractRecordsFromCSV(strings.NewReader(csv), map[string]string{"name": "姓名"}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	IndexFileSuffix = ".idx" // 索引文件的后缀，索引文件与加密记录文件位于同一目录，例如a.yinao.txt.idx
+	indexVersion    = 2      // 索引文件格式的版本，读取记录的方式变化时需要增加它，使旧的索引失效
+)
+
+// 索引中的一项，Key是哈希值的低8个字节
+type indexEntry struct {
+	Key    [8]byte
+	Offset int64
+}
+
+// 一个加密记录文件的索引，它可以被保存在文件旁边，再次载入时如果文件没有变化，就不必重新扫描文件
+type fileIndex struct {
+	Version     int               // 索引文件格式的版本
+	Size        int64             // 建立索引时文件的大小
+	ModTime     int64             // 建立索引时文件的修改时间（UnixNano）
+	ContentHash [sha256.Size]byte // 建立索引时文件内容的sha256，只在需要保存索引时才计算
+	Header      FileHeader        // 文件的头部
+	BaseInfo    []indexEntry      // 按BaseInfoHash建立的索引
+	ID          []indexEntry      // 按IDHash建立的索引，身份证号为NA的记录不在其中
+	Tombstones  []Record          // 文件中的撤回记录
+
+	Binary       bool     // 是否是二进制格式的文件，它的索引保存在文件内部，不需要保存在文件旁边
+	Descriptions []string // 二进制格式的文件中的描述表，读取记录时使用
+}
+
+// 文件在建立索引之后是否被修改过
+func (idx *fileIndex) stale(fi os.FileInfo) bool {
+	return idx.Size != fi.Size() || idx.ModTime != fi.ModTime().UnixNano()
+}
+
+// 计算文件内容的sha256
+func hashFile(f *os.File, size int64) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// 读取文件旁边的索引，并检查它与已打开的文件f是否一致。文件的大小和修改时间都没变时直接使用索引；
+// 只有修改时间变了（例如文件被复制过）时，再比较文件内容的sha256，相同时也使用索引，并更新其中的修改时间
+func loadIndex(fname string, f *os.File) *fileIndex {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	idxFile, err := os.Open(fname + IndexFileSuffix)
+	if err != nil {
+		return nil
+	}
+	idx := &fileIndex{}
+	err = gob.NewDecoder(idxFile).Decode(idx)
+	idxFile.Close()
+	if err != nil || idx.Version != indexVersion || idx.Size != fi.Size() {
+		return nil
+	}
+	// 索引文件本身没有签名，被篡改的索引可能带有伪造的撤回记录，所以像载入记录文件时一样重新检查它们
+	for i := range idx.Tombstones {
+		tomb := &idx.Tombstones[i]
+		if !tomb.IsTombstone() || !tomb.VerifyChecksum() || (tomb.IsSigned() && !tomb.VerifySignature()) {
+			return nil
+		}
+	}
+	if idx.ModTime == fi.ModTime().UnixNano() {
+		return idx
+	}
+	sum, err := hashFile(f, fi.Size())
+	if err != nil || sum != idx.ContentHash {
+		return nil
+	}
+	idx.ModTime = fi.ModTime().UnixNano()
+	saveIndex(fname, idx)
+	return idx
+}
+
+// 将索引保存在文件旁边。先写入临时文件再改名，避免留下写了一半的索引；保存失败（例如目录只读）时不影响使用
+func saveIndex(fname string, idx *fileIndex) {
+	tmp, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".*.tmp")
+	if err != nil {
+		return
+	}
+	err = gob.NewEncoder(tmp).Encode(idx)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fname+IndexFileSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// 扫描已打开的文件f，为其中的记录建立索引。索引只对应f中的内容：如果扫描期间文件被修改了，则返回错误
+func buildIndex(fname string, f *os.File, opts *LoadOptions) (*fileIndex, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	idx := &fileIndex{Version: indexVersion, Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+	if opts.UseIndex {
+		if idx.ContentHash, err = hashFile(f, fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+	var b bytes.Buffer
+	var shaNA [sha256.Size]byte
+	hasNA := false
+	hdr, err := extractEncRecords(io.NewSectionReader(f, 0, fi.Size()), fname, &b, func(hdr *FileHeader, rec *Record, off int64) error {
+		if !hasNA { //读到第一条记录时，根据文件头部确定哈希方法
+			hasher, err := ParseHasher(hdr.Scheme, opts.Secret)
+			if err != nil {
+				return fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
+			}
+			shaNA = hasher.Sum("NA")
+			hasNA = true
+		}
+		if rec.IsTombstone() {
+			idx.Tombstones = append(idx.Tombstones, *rec)
+			return nil
+		}
+		entry := indexEntry{Offset: off}
+		copy(entry.Key[:], rec.BaseInfoHash[:8])
+		idx.BaseInfo = append(idx.BaseInfo, entry)
+		if !bytes.Equal(rec.IDHash[:], shaNA[:]) {
+			copy(entry.Key[:], rec.IDHash[:8])
+			idx.ID = append(idx.ID, entry)
+		}
+		return nil
+	})
+	if err == nil && b.Len() != 0 {
+		err = fmt.Errorf("读取文件%s时，遇到错误：%s\n", fname, b.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi, err = f.Stat(); err != nil {
+		return nil, err
+	}
+	if idx.stale(fi) {
+		return nil, fmt.Errorf("读取文件%s时，文件被修改了", fname)
+	}
+	idx.Header = *hdr
+	return idx, nil
+}
+
+// 打开一个文件，并且得到它的索引：二进制格式的文件使用文件内部的索引；文本格式的文件优先使用文件旁边保存的索引，
+// 没有或者已经过期时扫描文件，并保存新的索引
+func openAndIndex(fname string, opts *LoadOptions) (*os.File, *fileIndex, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.HasSuffix(fname, BinFileSuffix) {
+		idx, err := loadBinIndex(fname, f, opts)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return f, idx, nil
+	}
+	var idx *fileIndex
+	if opts.UseIndex {
+		idx = loadIndex(fname, f)
+	}
+	if idx == nil {
+		if idx, err = buildIndex(fname, f, opts); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		if opts.UseIndex {
+			saveIndex(fname, idx)
+		}
+	}
+	return f, idx, nil
+}
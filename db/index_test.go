@@ -0,0 +1,99 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSidecarIndex(t *testing.T) {
+	recList, err := ExtractRecordsFromRawFile("../testdata/testconvert/origin1.txt")
+	assert.Equal(t, nil, err)
+	priv, _ := GenerateSigningKey()
+	recList[0].Sign(priv)
+	recList[1].Sign(priv)
+	tomb := NewTombstone(recList[0], "")
+	tomb.Sign(priv)
+	var b bytes.Buffer
+	err = WriteRecordsToFile(append(recList, tomb), &b)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile("./idx.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll("./idx.yinao.txt")
+	defer os.RemoveAll("./idx.yinao.txt" + IndexFileSuffix)
+
+	opts := &LoadOptions{UseIndex: true}
+	db, err := NewDBFromFilesWithOptions([]string{"./idx.yinao.txt"}, opts)
+	assert.Equal(t, nil, err)
+	db.Close()
+	idx := loadIndexOf(t, "./idx.yinao.txt")
+	assert.NotNil(t, idx)
+	assert.Equal(t, len(recList), len(idx.BaseInfo))
+	assert.Equal(t, 1, len(idx.Tombstones))
+
+	// 使用索引载入的数据库与扫描文件得到的相同
+	indexed, err := NewDBFromFilesWithOptions([]string{"./idx.yinao.txt"}, opts)
+	assert.Equal(t, nil, err)
+	scanned, err := NewDBFromFiles([]string{"./idx.yinao.txt"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, scanned.BaseInfoMap, indexed.BaseInfoMap)
+	assert.Equal(t, scanned.IDMap, indexed.IDMap)
+	assert.Equal(t, scanned.HeaderMap, indexed.HeaderMap)
+	assert.Equal(t, len(scanned.tombs), len(indexed.tombs))
+	res, err := indexed.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+	indexed.Close()
+	scanned.Close()
+
+	// 索引中被篡改的撤回记录无法通过签名检查，索引失效，不会撤回其他记录
+	idx = loadIndexOf(t, "./idx.yinao.txt")
+	idx.Tombstones[0].Retract = recList[1].Fingerprint()
+	saveIndex("./idx.yinao.txt", idx)
+	assert.Nil(t, loadIndexOf(t, "./idx.yinao.txt"))
+	db, err = NewDBFromFilesWithOptions([]string{"./idx.yinao.txt"}, opts)
+	assert.Equal(t, nil, err)
+	res, err = db.QueryBaseInfo(recList[1].BaseInfoHash)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+	db.Close()
+	assert.NotNil(t, loadIndexOf(t, "./idx.yinao.txt"))
+
+	// 只改变修改时间时，索引仍然有效
+	mtime := time.Now().Add(-time.Hour)
+	err = os.Chtimes("./idx.yinao.txt", mtime, mtime)
+	assert.Equal(t, nil, err)
+	idx = loadIndexOf(t, "./idx.yinao.txt")
+	assert.NotNil(t, idx)
+	assert.Equal(t, mtime.UnixNano(), idx.ModTime)
+
+	// 大小相同但内容改变时，索引失效，载入时会重建索引
+	dat := bytes.Replace(b.Bytes(), []byte("19.000000"), []byte("18.000000"), 1)
+	assert.NotEqual(t, b.Bytes(), dat)
+	err = ioutil.WriteFile("./idx.yinao.txt", dat, 0644)
+	assert.Equal(t, nil, err)
+	err = os.Chtimes("./idx.yinao.txt", time.Now(), time.Now())
+	assert.Equal(t, nil, err)
+	assert.Nil(t, loadIndexOf(t, "./idx.yinao.txt"))
+	db, err = NewDBFromFilesWithOptions([]string{"./idx.yinao.txt"}, opts)
+	assert.Equal(t, nil, err)
+	db.Close()
+	assert.NotNil(t, loadIndexOf(t, "./idx.yinao.txt"))
+
+	// 大小改变时，索引失效
+	err = ioutil.WriteFile("./idx.yinao.txt", b.Bytes()[:len(b.Bytes())-1], 0644)
+	assert.Equal(t, nil, err)
+	assert.Nil(t, loadIndexOf(t, "./idx.yinao.txt"))
+}
+
+// 打开文件并读取它的索引
+func loadIndexOf(t *testing.T, fname string) *fileIndex {
+	f, err := os.Open(fname)
+	assert.Equal(t, nil, err)
+	defer f.Close()
+	return loadIndex(fname, f)
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 记录的JSON表示，供命令行工具和其他程序使用
+type RecordJSON struct {
+	BaseInfoHash string  `json:"base_info_hash"`          // 基本信息哈希值的base64编码
+	IDHash       string  `json:"id_hash"`                 // 身份证号哈希值的base64编码
+	Confidence   float32 `json:"confidence"`              // 置信参数
+	Description  string  `json:"description"`             // 对医闹行为的描述
+	Crc32        string  `json:"crc32"`                   // 校验码（Hex编码）
+	Signer       string  `json:"signer,omitempty"`        // 签名者公钥的base64编码，没有签名时为空
+	Signature    string  `json:"signature,omitempty"`     // 签名的base64编码，没有签名时为空
+	Retract      string  `json:"retract,omitempty"`       // 被撤回记录的指纹的base64编码，仅撤回记录才有
+	FileName     string  `json:"file_name,omitempty"`     // 此记录来自哪个文件
+	BaseInfo     string  `json:"base_info,omitempty"`     // 与BaseInfoHash相匹配的基本信息明文
+	ID           string  `json:"id,omitempty"`            // 与IDHash相匹配的身份证号明文
+	Decrypted    bool    `json:"decrypted,omitempty"`     // Description是否是解密之后的描述
+	IncidentDate string  `json:"incident_date,omitempty"` // 医闹事件发生的日期
+	PublishDate  string  `json:"publish_date,omitempty"`  // 记录被发布的日期
+	AgeDays      *int    `json:"age_days,omitempty"`      // 查询时记录的年龄（天数），没有日期时为空
+}
+
+// 将记录转为JSON表示
+func (rec *Record) ToJSON() *RecordJSON {
+	j := &RecordJSON{
+		BaseInfoHash: base64.StdEncoding.EncodeToString(rec.BaseInfoHash[:]),
+		IDHash:       base64.StdEncoding.EncodeToString(rec.IDHash[:]),
+		Confidence:   rec.Confidence,
+		Description:  rec.Description,
+		Crc32:        fmt.Sprintf("%08x", rec.Crc32),
+	}
+	if rec.IsSigned() {
+		j.Signer = rec.SignerID()
+		j.Signature = base64.StdEncoding.EncodeToString(rec.Signature[:])
+	}
+	if !rec.IncidentDate.IsZero() {
+		j.IncidentDate = rec.IncidentDate.Format(DateLayout)
+	}
+	if !rec.PublishDate.IsZero() {
+		j.PublishDate = rec.PublishDate.Format(DateLayout)
+	}
+	if rec.IsTombstone() {
+		j.Retract = base64.StdEncoding.EncodeToString(rec.Retract[:])
+	}
+	return j
+}
+
+// 将文件中的记录转为JSON表示，其中包含来源文件和查询时匹配的明文
+func (rec *RecordInFile) ToJSON() *RecordJSON {
+	j := rec.Record.ToJSON()
+	j.FileName = rec.FileName
+	j.BaseInfo = rec.BaseInfo
+	j.ID = rec.ID
+	j.Decrypted = rec.Decrypted
+	if rec.AgeDays >= 0 {
+		ageDays := rec.AgeDays
+		j.AgeDays = &ageDays
+	}
+	return j
+}
+
+// 将JSON表示转回记录，并和加密记录文件中的记录一样检查校验码和签名。
+// 按前缀查询的客户端用它在本地比较完整的哈希值、解密描述
+func (j *RecordJSON) ToRecord() (*Record, error) {
+	var b bytes.Buffer
+	rec := parseLines(j.toLines(), &b)
+	if rec == nil {
+		return nil, fmt.Errorf("%s", strings.Join(strings.Fields(b.String()), " "))
+	}
+	return rec, nil
+}
+
+// 转为加密记录文件中的各行，以便和加密记录文件中的记录一样，用parseLines进行检查
+func (j *RecordJSON) toLines() []string {
+	lines := []string{
+		j.BaseInfoHash,
+		j.IDHash,
+		strconv.FormatFloat(float64(j.Confidence), 'f', -1, 32),
+		j.Description,
+		j.Crc32,
+	}
+	if len(j.IncidentDate) != 0 {
+		lines = append(lines, "date: "+j.IncidentDate)
+	}
+	if len(j.PublishDate) != 0 {
+		lines = append(lines, "published: "+j.PublishDate)
+	}
+	if len(j.Retract) != 0 {
+		lines = append(lines, "retract: "+j.Retract)
+	}
+	if len(j.Signer) != 0 || len(j.Signature) != 0 {
+		lines = append(lines, "sig: "+j.Signer+" "+j.Signature)
+	}
+	return lines
+}
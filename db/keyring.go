@@ -0,0 +1,131 @@
+package db
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 密钥环文件中的特殊主体
+const (
+	KeyringDefault  = "default"  // 不在密钥环中的贡献者
+	KeyringUnsigned = "unsigned" // 没有签名的记录
+)
+
+// 对某个贡献者的信任设置
+type TrustEntry struct {
+	Name    string  // 贡献者的昵称，可以为空
+	Blocked bool    // 为true时丢弃此贡献者的所有记录
+	Delta   float32 // 对此贡献者的记录的置信参数调整值
+}
+
+// 密钥环，保存了对各个贡献者（以其公钥标识）的信任设置，在合并记录时使用
+type Keyring struct {
+	Default  TrustEntry // 不在密钥环中的贡献者使用的设置
+	Unsigned TrustEntry // 没有签名的记录使用的设置
+
+	m map[[ed25519.PublicKeySize]byte]TrustEntry
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{m: make(map[[ed25519.PublicKeySize]byte]TrustEntry)}
+}
+
+// 贡献者的个数，不包括default和unsigned
+func (kr *Keyring) Len() int {
+	return len(kr.m)
+}
+
+// 设置对某个贡献者的信任
+func (kr *Keyring) Set(pub ed25519.PublicKey, entry TrustEntry) {
+	var key [ed25519.PublicKeySize]byte
+	copy(key[:], pub)
+	kr.m[key] = entry
+}
+
+// 查找对某条记录的贡献者的信任设置
+func (kr *Keyring) Lookup(rec *Record) TrustEntry {
+	if !rec.IsSigned() {
+		return kr.Unsigned
+	}
+	if entry, ok := kr.m[rec.Signer]; ok {
+		return entry
+	}
+	return kr.Default
+}
+
+// 从文件中读取密钥环
+func LoadKeyring(fname string) (*Keyring, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	kr, err := ParseKeyring(f)
+	if err != nil {
+		return nil, fmt.Errorf("密钥环文件%s%s", fname, err.Error())
+	}
+	return kr, nil
+}
+
+// 解析密钥环。每行的格式为“主体 allow|block [置信参数调整值] [昵称]”，
+// 主体是贡献者的公钥，或者default、unsigned；空行和以#开头的行会被忽略
+func ParseKeyring(r io.Reader) (*Keyring, error) {
+	kr := NewKeyring()
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := kr.parseLine(line); err != nil {
+			return nil, fmt.Errorf("第%d行：%s", lineNum, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+func (kr *Keyring) parseLine(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("格式错误，必须是“主体 allow|block [置信参数调整值] [昵称]”：%s", line)
+	}
+	entry := TrustEntry{}
+	switch fields[1] {
+	case "allow":
+	case "block":
+		entry.Blocked = true
+	default:
+		return fmt.Errorf("未知的状态%s，只能是allow或block", fields[1])
+	}
+	rest := fields[2:]
+	if len(rest) != 0 {
+		if delta, err := strconv.ParseFloat(rest[0], 32); err == nil {
+			entry.Delta = float32(delta)
+			rest = rest[1:]
+		}
+	}
+	entry.Name = strings.Join(rest, " ")
+	switch fields[0] {
+	case KeyringDefault:
+		kr.Default = entry
+	case KeyringUnsigned:
+		kr.Unsigned = entry
+	default:
+		pub, err := ParsePublicKey(fields[0])
+		if err != nil {
+			return err
+		}
+		kr.Set(pub, entry)
+	}
+	return nil
+}
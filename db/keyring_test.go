@@ -0,0 +1,73 @@
+package db
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyring(t *testing.T) {
+	priv1, _ := GenerateSigningKey()
+	priv2, _ := GenerateSigningKey()
+	pub1 := FormatPublicKey(priv1.Public().(ed25519.PublicKey))
+	pub2 := FormatPublicKey(priv2.Public().(ed25519.PublicKey))
+	txt := "# 同事们的公钥\n" +
+		pub1 + " allow 5 张 医生\n" +
+		pub2 + " block\n\n" +
+		"default allow -10\n" +
+		"unsigned block\n"
+	kr, err := ParseKeyring(strings.NewReader(txt))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, kr.Len())
+	assert.Equal(t, TrustEntry{Delta: -10}, kr.Default)
+	assert.Equal(t, TrustEntry{Blocked: true}, kr.Unsigned)
+
+	rec := NewRecord("张三，男，2000", "NA", 80, "abc")
+	assert.Equal(t, kr.Unsigned, kr.Lookup(rec))
+	rec.Sign(priv1)
+	assert.Equal(t, TrustEntry{Name: "张 医生", Delta: 5}, kr.Lookup(rec))
+	rec.Sign(priv2)
+	assert.Equal(t, TrustEntry{Blocked: true}, kr.Lookup(rec))
+	priv3, _ := GenerateSigningKey()
+	rec.Sign(priv3)
+	assert.Equal(t, kr.Default, kr.Lookup(rec))
+
+	_, err = ParseKeyring(strings.NewReader("default\n"))
+	assert.Contains(t, err.Error(), "第1行：格式错误")
+	_, err = ParseKeyring(strings.NewReader("\ndefault trust\n"))
+	assert.Contains(t, err.Error(), "第2行：未知的状态trust")
+	_, err = ParseKeyring(strings.NewReader("abc allow\n"))
+	assert.Contains(t, err.Error(), "公钥的格式错误")
+}
+
+func TestRecordsWithKeyring(t *testing.T) {
+	trusted, _ := GenerateSigningKey()
+	blocked, _ := GenerateSigningKey()
+	stranger, _ := GenerateSigningKey()
+	kr := NewKeyring()
+	kr.Set(trusted.Public().(ed25519.PublicKey), TrustEntry{Delta: 10})
+	kr.Set(blocked.Public().(ed25519.PublicKey), TrustEntry{Blocked: true})
+	kr.Default = TrustEntry{Delta: -20}
+	kr.Unsigned = TrustEntry{Delta: -30}
+
+	records := NewRecords()
+	records.Keyring = kr
+	for i, priv := range []ed25519.PrivateKey{trusted, blocked, stranger, nil} {
+		rec := NewRecord("张三，男，2000", "NA", 50, strings.Repeat("a", i+1))
+		if priv != nil {
+			rec.Sign(priv)
+		}
+		records.Add(*rec, 1)
+	}
+	assert.Equal(t, 3, records.Len())
+	assert.Equal(t, 1, records.Blocked())
+	conf := make(map[string]float32)
+	for _, recList := range records.m {
+		for _, rec := range recList {
+			conf[rec.Description] = rec.Confidence
+		}
+	}
+	assert.Equal(t, map[string]float32{"a": 61, "aaa": 31, "aaaa": 21}, conf)
+}
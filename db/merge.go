@@ -18,15 +18,117 @@ const (
 )
 
 type Records struct {
-	m map[uint32][]*Record
+	Creator string       // 写入文件头部的创建者，可以为空
+	Keyring *Keyring     // 对各个贡献者的信任设置，为nil时不区分贡献者
+	Decay   *DecayPolicy // 不为nil时丢弃超过最大年龄的记录；合并时置信参数不会衰减，以免多次合并时重复衰减
+
+	m             map[uint32][]*Record
+	scheme        string     // 这些记录所使用的哈希方案，使用其他哈希方案的记录无法被合并进来
+	normalization int        // 这些记录所使用的规范化方法的版本，使用其他版本的记录无法被合并进来
+	normalized    bool       // 是否已经有记录加入，为false时normalization取第一个被合并的文件所使用的版本
+	blocked       int        // 因为贡献者被屏蔽而丢弃的记录条数
+	tombs         tombstones // 已经加入的撤回记录
+	retracted     int        // 因为被撤回而丢弃的记录条数
+	unsigned      int        // 因为没有签名而被忽略的撤回记录条数
+	expired       int        // 因为太旧而丢弃的记录条数
+	dirty         bool       // 是否有新的撤回记录，还没有用它们清理已有的记录
 }
 
 func NewRecords() *Records {
-	return &Records{m: make(map[uint32][]*Record)}
+	return NewRecordsWithScheme(SchemeSHA256)
+}
+
+// 创建一个记录集合，只有使用scheme这个哈希方案的记录才能被合并进来
+func NewRecordsWithScheme(scheme string) *Records {
+	return &Records{
+		m:             make(map[uint32][]*Record),
+		scheme:        scheme,
+		normalization: NormalizationVersion,
+		tombs:         make(tombstones),
+	}
+}
+
+// 记录的条数，包括撤回记录
+func (recs *Records) Len() int {
+	recs.prune()
+	n := 0
+	for _, recList := range recs.m {
+		n += len(recList)
+	}
+	return n
+}
+
+// 因为贡献者被屏蔽而丢弃的记录条数
+func (recs *Records) Blocked() int {
+	return recs.blocked
+}
+
+// 因为太旧而丢弃的记录条数
+func (recs *Records) Expired() int {
+	return recs.expired
+}
+
+// 因为被撤回而丢弃的记录条数
+func (recs *Records) Retracted() int {
+	recs.prune()
+	return recs.retracted
+}
+
+// 因为没有签名而被忽略的撤回记录条数
+func (recs *Records) UnsignedTombstones() int {
+	return recs.unsigned
+}
+
+// 用新增的撤回记录清理已有的记录。撤回记录可能晚于被撤回的记录加入，所以在使用记录之前进行清理
+func (recs *Records) prune() {
+	if !recs.dirty {
+		return
+	}
+	recs.dirty = false
+	for key, recList := range recs.m {
+		kept := recList[:0]
+		for _, rec := range recList {
+			if recs.tombs.retracts(rec) {
+				recs.retracted++
+			} else {
+				kept = append(kept, rec)
+			}
+		}
+		if len(kept) == 0 {
+			delete(recs.m, key)
+		} else {
+			recs.m[key] = kept
+		}
+	}
 }
 
-// 增加一条新的记录
+// 增加一条新的记录，如果设置了密钥环，还会根据记录的贡献者调整置信参数或者丢弃记录。
+// 已被撤回的记录会被丢弃，撤回记录本身则会被保留，以便在以后的合并中继续生效
 func (recs *Records) Add(rec Record, confDelta float32) {
+	recs.normalized = true
+	if recs.Keyring != nil {
+		entry := recs.Keyring.Lookup(&rec)
+		if entry.Blocked {
+			recs.blocked++
+			return
+		}
+		confDelta += entry.Delta
+	}
+	if recs.tombs.retracts(&rec) {
+		recs.retracted++
+		return
+	}
+	if !rec.IsTombstone() && recs.Decay.Expired(&rec) {
+		recs.expired++
+		return
+	}
+	if rec.IsTombstone() && !rec.IsSigned() {
+		recs.unsigned++
+		return //没有签名的撤回记录不会生效，也不再转发
+	}
+	if rec.IsTombstone() && recs.tombs.add(&rec) {
+		recs.dirty = true
+	}
 	rec.Confidence = rec.Confidence + confDelta
 	if rec.Confidence > 100.0 {
 		rec.Confidence = 100.0
@@ -57,21 +159,13 @@ func (recs *Records) Add(rec Record, confDelta float32) {
 	}
 }
 
-// 扫描一个目录及其子目录下的.yinao.txt文件，读取其中的加密医闹记录，并且调整这些记录的置信参数
+// 扫描一个目录及其子目录下的.yinao.txt和.yinao.bin文件，读取其中的加密医闹记录，并且调整这些记录的置信参数
 func (recs *Records) AddEncRecordsInDir(dir string, confDelta float32, errLog io.Writer) {
 	files, subdirs := getFilesAndSubDirs(dir, errLog)
 	for _, f := range files {
-		err := extractRecordsFromFile(f, func(recLines []string, off int64) error {
-			rec := parseLines(recLines, errLog)
-			if rec != nil {
-				recs.Add(*rec, confDelta)
-			}
-			return nil
-		})
-		if err != nil {
+		if err := recs.AddEncRecordsInFile(f, confDelta, errLog); err != nil { // 跳过出错的文件，继续处理其他文件
 			errLog.Write([]byte(err.Error()))
 			errLog.Write([]byte("\n"))
-			return
 		}
 	}
 	for _, subdir := range subdirs { // 递归地扫描子目录
@@ -79,8 +173,36 @@ func (recs *Records) AddEncRecordsInDir(dir string, confDelta float32, errLog io
 	}
 }
 
-// 将各条记录写入文件
-func (recs *Records) WriteToFile(file io.Writer) (err error) {
+// 读取一个加密记录文件中的记录，并且调整这些记录的置信参数。有错误的记录会被写入errLog并被跳过，
+// 文件本身有错误或者使用的哈希方案不同时返回错误
+func (recs *Records) AddEncRecordsInFile(fname string, confDelta float32, errLog io.Writer) error {
+	_, err := extractEncRecordsFromFile(fname, errLog, func(hdr *FileHeader, rec *Record, off int64) error {
+		return recs.addFromFile(hdr, rec, confDelta, fname, errLog)
+	})
+	return err
+}
+
+// 加入从头部为hdr的文件f中读取的一条记录，文件使用的哈希方案不同时返回错误，没有签名的撤回记录会被写入errLog
+func (recs *Records) addFromFile(hdr *FileHeader, rec *Record, confDelta float32, f string, errLog io.Writer) error {
+	if hdr.Scheme != recs.scheme {
+		return fmt.Errorf("文件%s使用的哈希方案%s与合并时指定的哈希方案%s不同，无法合并", f, hdr.Scheme, recs.scheme)
+	}
+	// 文件头部只能注明一个规范化方法的版本，混在一起之后就无法得知各条记录的哈希值是按哪个版本计算的
+	if !recs.normalized {
+		recs.normalization = hdr.Normalization
+	} else if hdr.Normalization != recs.normalization {
+		return fmt.Errorf("文件%s使用的规范化方法的版本%d与其他文件的版本%d不同，无法合并", f, hdr.Normalization, recs.normalization)
+	}
+	if rec.IsTombstone() && !rec.IsSigned() {
+		errLog.Write([]byte(fmt.Sprintf("文件%s中的撤回记录没有签名，已被忽略：%s\n", f, rec.Description)))
+	}
+	recs.Add(*rec, confDelta)
+	return nil
+}
+
+// 按校验码排序的各条记录
+func (recs *Records) sorted() []*Record {
+	recs.prune()
 	keys := make([]uint32, 0, len(recs.m))
 	for k := range recs.m {
 		keys = append(keys, k)
@@ -89,32 +211,23 @@ func (recs *Records) WriteToFile(file io.Writer) (err error) {
 	sort.Slice(keys, func(i, j int) bool {
 		return keys[i] < keys[j]
 	})
+	res := make([]*Record, 0, len(recs.m))
 	for _, key := range keys {
-		recList := recs.m[key]
-		for _, rec := range recList {
-			for _, line := range rec.ToLines() {
-				_, err = file.Write([]byte(line))
-				if err != nil {
-					return
-				}
-				_, err = file.Write([]byte("\n"))
-				if err != nil {
-					return
-				}
-			}
-			_, err = file.Write([]byte("\n"))
-			if err != nil {
-				return
-			}
-		}
+		res = append(res, recs.m[key]...)
 	}
-	return
+	return res
+}
+
+// 将各条记录写入文件
+func (recs *Records) WriteToFile(file io.Writer) error {
+	hdr := &FileHeader{Scheme: recs.scheme, Creator: recs.Creator, Normalization: recs.normalization}
+	return WriteRecordsToFileWithHeader(hdr, recs.sorted(), file)
 }
 
 // 将若干行的加密医闹记录，转换为一个Record
 func parseLines(recLines []string, errLog io.Writer) *Record {
-	if len(recLines) != 5 {
-		s := fmt.Sprintf("记录的长度错误，必须正好有5行：%s\n", strings.Join(recLines, "\n"))
+	if len(recLines) < 5 {
+		s := fmt.Sprintf("记录的长度错误，必须至少有5行：%s\n", strings.Join(recLines, "\n"))
 		errLog.Write([]byte(s))
 		return nil
 	}
@@ -157,12 +270,29 @@ func parseLines(recLines []string, errLog io.Writer) *Record {
 		errLog.Write([]byte(fmt.Sprintf("校验码编码格式错误：%s\n", recLines[4])))
 		return nil
 	}
+	if len(crcBz) != 4 {
+		errLog.Write([]byte(fmt.Sprintf("校验码长度错误：%s\n", recLines[4])))
+		return nil
+	}
 	rec.Crc32 = binary.BigEndian.Uint32(crcBz)
 	if !rec.VerifyChecksum() {
 		s := fmt.Sprintf("校验码错误：%s\n", strings.Join(recLines, "\n"))
 		errLog.Write([]byte(s))
 		return nil
 	}
+	//从第六行开始是扩展行，格式为“键: 值”
+	for _, line := range recLines[5:] {
+		if err := rec.parseExtension(line); err != nil {
+			errLog.Write([]byte(err.Error()))
+			errLog.Write([]byte("\n"))
+			return nil
+		}
+	}
+	if rec.IsSigned() && !rec.VerifySignature() {
+		s := fmt.Sprintf("签名错误，记录可能被篡改过：%s\n", strings.Join(recLines, "\n"))
+		errLog.Write([]byte(s))
+		return nil
+	}
 	return rec
 }
 
@@ -177,7 +307,7 @@ func getFilesAndSubDirs(dir string, errLog io.Writer) (files []string, subdirs [
 		fullName := path.Join(dir, item.Name())
 		if item.IsDir() {
 			subdirs = append(subdirs, fullName)
-		} else if strings.HasSuffix(fullName, EncFileSuffix) {
+		} else if strings.HasSuffix(fullName, EncFileSuffix) || strings.HasSuffix(fullName, BinFileSuffix) {
 			files = append(files, fullName)
 		}
 	}
@@ -40,11 +40,22 @@ func prepareInput() {
 	convertAndWriteToFile(File4, "./b/c/4.yinao.txt")
 }
 
-var result = `NodIhJ4+FFFrYJmBrfMwB/VaxZwfsGcCaeHzyL/cZjk=
-uKZuKBb825p2vFxrb4iapZj5v8K4GCVmd6VWY8y5bw4=
-88.000000
-空里流霜不觉飞，汀上白沙看不见。
-3812db55
+var result = `#YinaoBlacklist
+version: 6
+hash: sha256
+normalize: 1
+
+ML57MxkS7gMvATP+AmyBMLjF3/I+Hi9qb7JGqCh0VoA=
+IMUg+gy1wkG9UnqY2UaiA0Xwq1Q/NkxqQJR88cYuSJM=
+87.000000
+举头望明月，低头思故乡。\n露从今夜白，月是故乡明。
+090c12b6
+
+mZyjgFob2OSxIqbUXIK9vHqdmttJJSsJ/xbm++tAfZs=
+ExYa2xg+oJ+u0PMOZXmslebrYBiXxJ3rprx1rltLKl8=
+100.000000
+春江潮水连海平，海上明月共潮生。\n滟滟随波千万里，何处春江无月明？
+0b9117d7
 
 pE/xp/CKOkj6X6sqPIM2iBqO6vC2YUAn2EYrNurHejE=
 IO8PDI0O6ph3JBLOqbO5JhLj5Ty15ZFStXAxZfVuilM=
@@ -52,35 +63,29 @@ IO8PDI0O6ph3JBLOqbO5JhLj5Ty15ZFStXAxZfVuilM=
 江流宛转绕芳甸，月照花林皆似霰。\n空里流霜不觉飞，汀上白沙看不见。
 4eeed005
 
-QkedkZm8Eq2KyQg/DeQWN+b92Z2M651NfpxF/9UCmVU=
-IO8PDI0O6ph3JBLOqbO5JhLj5Ty15ZFStXAxZfVuilM=
-87.000000
-春江潮水连海平，海上明月共潮生。\n滟滟随波千万里，何处春江无月明？
-5e437216
-
 77tvf7/2R95SVd7b0p6V05SVgvPZc+aspC7oj5Q5WOY=
-qRrk3oLyVGxF1zpO6bW4n0E4INNTxTy+8p+FRj0H2jE=
+IMUg+gy1wkG9UnqY2UaiA0Xwq1Q/NkxqQJR88cYuSJM=
 89.000000
 春江潮水连海平，海上明月共潮生。\n滟滟随波千万里，何处春江无月明？
-770a6955
-
-mZyjgFob2OSxIqbUXIK9vHqdmttJJSsJ/xbm++tAfZs=
-fOf06IsxgCcL4uarx8i4D4r6hyuNPRZll116H+v7pl4=
-100.000000
-春江潮水连海平，海上明月共潮生。\n滟滟随波千万里，何处春江无月明？
-be038bab
+5dec0224
 
 QkedkZm8Eq2KyQg/DeQWN+b92Z2M651NfpxF/9UCmVU=
-qRrk3oLyVGxF1zpO6bW4n0E4INNTxTy+8p+FRj0H2jE=
+IO8PDI0O6ph3JBLOqbO5JhLj5Ty15ZFStXAxZfVuilM=
 87.000000
-举头望明月，低头思故乡。\n露从今夜白，月是故乡明。
-c2af2fa4
+春江潮水连海平，海上明月共潮生。\n滟滟随波千万里，何处春江无月明？
+5e437216
 
 NodIhJ4+FFFrYJmBrfMwB/VaxZwfsGcCaeHzyL/cZjk=
-uKZuKBb825p2vFxrb4iapZj5v8K4GCVmd6VWY8y5bw4=
+Ca1GSHMSPmRYhIp/lMqyVDzGu95bwXfVnOXKr2m4am0=
+88.000000
+空里流霜不觉飞，汀上白沙看不见。
+bbde34f4
+
+NodIhJ4+FFFrYJmBrfMwB/VaxZwfsGcCaeHzyL/cZjk=
+Ca1GSHMSPmRYhIp/lMqyVDzGu95bwXfVnOXKr2m4am0=
 100.000000
 江流宛转绕芳甸，月照花林皆似霰。\n空里流霜不觉飞，汀上白沙看不见。
-ea839b7a
+c4a068d3
 
 `
 
@@ -167,7 +172,7 @@ ea83-9b7a`
 
 	logfile.Close()
 
-	result := `记录的长度错误，必须正好有5行：NodIhJ4+FFFrYJmBrfMwB/VaxZwfsGcCaeHzyL/cZjk=
+	result := `记录的长度错误，必须至少有5行：NodIhJ4+FFFrYJmBrfMwB/VaxZwfsGcCaeHzyL/cZjk=
 uKZuKBb825p2vFxrb4iapZj5v8K4GCVmd6VWY8y5bw4=
 江流宛转绕芳甸，月照花林皆似霰。\n空里流霜不觉飞，汀上白沙看不见。
 ea839b7a
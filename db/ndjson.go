@@ -0,0 +1,186 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// NDJSON格式中的文件头部，各字段与加密记录文件的头部相同
+type jsonHeader struct {
+	Version       int    `json:"version"`
+	Scheme        string `json:"hash"`
+	Normalization int    `json:"normalize,omitempty"`
+	Creator       string `json:"creator,omitempty"`
+}
+
+// NDJSON格式中的一行，它是文件头部或者一条记录。记录的各个字段与查询服务和-json输出中的RecordJSON相同，
+// 其中file_name是记录所在的加密记录文件，导出数据库时才有。写入头部时使用jsonHeaderLine，以免写入记录的各个字段
+type jsonLine struct {
+	Header *jsonHeader `json:"header,omitempty"`
+	RecordJSON
+}
+
+// NDJSON格式中文件头部的一行
+type jsonHeaderLine struct {
+	Header   *jsonHeader `json:"header"`
+	FileName string      `json:"file_name,omitempty"`
+}
+
+func newJSONHeader(hdr *FileHeader) *jsonHeader {
+	return &jsonHeader{Version: hdr.Version, Scheme: hdr.Scheme, Normalization: hdr.Normalization, Creator: hdr.Creator}
+}
+
+// 转为FileHeader，和加密记录文件的头部一样进行检查
+func (jh *jsonHeader) toFileHeader() (*FileHeader, error) {
+	if jh.Version == 1 { //版本1的文件没有头部，导出数据库时仍然会为它写入一个头部
+		if jh.Scheme != SchemeSHA256 || jh.Normalization != 0 {
+			return nil, fmt.Errorf("版本1的文件只能使用sha256哈希方案，不能有normalize字段")
+		}
+		return defaultHeader(), nil
+	}
+	lines := []string{FileMagic, fmt.Sprintf("version: %d", jh.Version), "hash: " + jh.Scheme}
+	if jh.Normalization != 0 {
+		lines = append(lines, fmt.Sprintf("normalize: %d", jh.Normalization))
+	}
+	hdr, err := parseHeader(lines)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Creator = jh.Creator
+	return hdr, nil
+}
+
+// 将一行JSON写入w
+func writeJSONLine(w io.Writer, line interface{}) error {
+	bz, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bz, '\n'))
+	return err
+}
+
+// 以NDJSON格式写入文件头部和各条记录，hdr为nil时与WriteRecordsToFileWithHeader一样处理。
+// 写入的头部中的版本是本程序所使用的格式版本
+func WriteRecordsToNDJSON(hdr *FileHeader, recList []*Record, w io.Writer) error {
+	if hdr == nil {
+		hdr = &FileHeader{Scheme: SchemeSHA256, Normalization: NormalizationVersion}
+	}
+	jh := newJSONHeader(hdr)
+	jh.Version = FormatVersion
+	if err := writeJSONLine(w, &jsonHeaderLine{Header: jh}); err != nil {
+		return err
+	}
+	for _, rec := range recList {
+		if err := writeJSONLine(w, &jsonLine{RecordJSON: *rec.ToJSON()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从NDJSON格式的r中读取记录，每条记录都和加密记录文件中的一样进行检查，有错误的记录会被写入errLog并被跳过。
+// 没有头部时按版本1的文件处理。头部可以出现多次（例如导出数据库时每个文件一个头部），之后的记录使用最近的头部
+func extractJSONRecords(r io.Reader, errLog io.Writer, fn func(hdr *FileHeader, rec *Record, file string) error) error {
+	hdr := defaultHeader()
+	rr := newRecordReader(r)
+	for n := 1; ; n++ {
+		text, _, err := rr.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+		var line jsonLine
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			fmt.Fprintf(errLog, "第%d行不是合法的JSON：%s\n", n, err.Error())
+			continue
+		}
+		if line.Header != nil {
+			if hdr, err = line.Header.toFileHeader(); err != nil {
+				return fmt.Errorf("第%d行：%s", n, err.Error())
+			}
+			continue
+		}
+		if line.RecordJSON == (RecordJSON{FileName: line.FileName}) { //只有文件名时也不是记录
+			fmt.Fprintf(errLog, "第%d行中没有记录\n", n)
+			continue
+		}
+		recLines := line.RecordJSON.toLines()
+		if hdr.Version < 3 && len(recLines) != 5 {
+			fmt.Fprintf(errLog, "第%d行：版本%d的文件中的记录不能有扩展字段\n", n, hdr.Version)
+			continue
+		}
+		var b bytes.Buffer
+		rec := parseLines(recLines, &b)
+		if rec == nil {
+			//错误信息中可能带有记录的各行，合并为一行，使每一行输入只对应一行错误信息
+			fmt.Fprintf(errLog, "第%d行：%s\n", n, strings.Replace(strings.TrimSpace(b.String()), "\n", " ", -1))
+			continue
+		}
+		if err := fn(hdr, rec, line.FileName); err != nil {
+			return err
+		}
+	}
+}
+
+// 将记录以NDJSON格式写入w，与WriteToFile写入的记录和顺序都相同
+func (recs *Records) WriteToNDJSON(w io.Writer) error {
+	hdr := &FileHeader{Scheme: recs.scheme, Creator: recs.Creator, Normalization: recs.normalization}
+	return WriteRecordsToNDJSON(hdr, recs.sorted(), w)
+}
+
+// 读取NDJSON格式的记录（例如用WriteToNDJSON或者DB.ExportNDJSON导出的），调整它们的置信参数之后加入进来。
+// 有错误的记录会被写入errLog并被跳过，使用的哈希方案不同时返回错误
+func (recs *Records) AddNDJSON(r io.Reader, confDelta float32, errLog io.Writer) error {
+	return extractJSONRecords(r, errLog, func(hdr *FileHeader, rec *Record, file string) error {
+		if len(file) == 0 {
+			file = "NDJSON输入"
+		}
+		return recs.addFromFile(hdr, rec, confDelta, file, errLog)
+	})
+}
+
+// 将数据库中各个文件的头部和记录以NDJSON格式写入w，每个文件的头部和记录都带有文件名。
+// 导出的是文件中原有的记录，包括撤回记录，置信参数也没有经过衰减
+func (db *DB) ExportNDJSON(w io.Writer) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return fmt.Errorf("数据库已经关闭")
+	}
+	for _, fname := range db.fileList {
+		if err := db.checkFile(fname); err != nil {
+			return err
+		}
+		if err := writeJSONLine(w, &jsonHeaderLine{Header: newJSONHeader(db.HeaderMap[fname]), FileName: fname}); err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		r := io.NewSectionReader(db.FileMap[fname], 0, math.MaxInt64)
+		extract := extractEncRecords
+		if db.indexes[fname].Binary {
+			extract = extractBinRecords
+		}
+		_, err := extract(r, fname, &b, func(hdr *FileHeader, rec *Record, off int64) error {
+			j := rec.ToJSON()
+			j.FileName = fname
+			return writeJSONLine(w, &jsonLine{RecordJSON: *j})
+		})
+		if err == nil && b.Len() != 0 {
+			err = fmt.Errorf("读取文件%s时，遇到错误：%s", fname, b.String())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
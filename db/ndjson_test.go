@@ -0,0 +1,113 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONRoundTrip(t *testing.T) {
+	err := ioutil.WriteFile("./in.txt", []byte(File1+"\n"+File3), 0644)
+	assert.Nil(t, err)
+	priv, err := GenerateSigningKey()
+	assert.Nil(t, err)
+	opts := &ConvertOptions{SigningKey: priv, PublishDate: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)}
+	recList, err := ExtractRecordsFromRawFileWithOptions("./in.txt", opts)
+	assert.Nil(t, err)
+	os.RemoveAll("./in.txt")
+	recList[1].Confidence = 12.345678 //不能用%f精确表示的置信参数在NDJSON中也不会丢失精度
+	tomb := NewTombstone(recList[0], "")
+	tomb.Sign(priv)
+	recList = append(recList, tomb)
+
+	records := NewRecords()
+	records.Creator = "张医生"
+	for _, rec := range recList {
+		records.Add(*rec, 0)
+	}
+	var expected, ndjson bytes.Buffer
+	assert.Nil(t, records.WriteToFile(&expected))
+	assert.Nil(t, records.WriteToNDJSON(&ndjson))
+	assert.Equal(t, records.Len()+1, strings.Count(ndjson.String(), "\n"))
+
+	imported := NewRecords()
+	imported.Creator = "张医生"
+	var errLog bytes.Buffer
+	assert.Nil(t, imported.AddNDJSON(&ndjson, 0, &errLog))
+	assert.Equal(t, "", errLog.String())
+	var actual bytes.Buffer
+	assert.Nil(t, imported.WriteToFile(&actual))
+	assert.Equal(t, expected.String(), actual.String())
+	assert.Equal(t, records.sorted()[1].Confidence, imported.sorted()[1].Confidence)
+
+	// 导出数据库中的记录，每行都带有文件名，再导入之后与原来的文件相同
+	err = ioutil.WriteFile("./nd.yinao.txt", expected.Bytes(), 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./nd.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./nd.yinao.txt"})
+	assert.Nil(t, err)
+	ndjson.Reset()
+	assert.Nil(t, db.ExportNDJSON(&ndjson))
+	db.Close()
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	assert.Equal(t, records.Len()+1, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], `{"header":{"version":6,"hash":"sha256","normalize":1`))
+	for _, line := range lines {
+		assert.Contains(t, line, `"file_name":"./nd.yinao.txt"`)
+	}
+	imported = NewRecords()
+	imported.Creator = "张医生"
+	assert.Nil(t, imported.AddNDJSON(&ndjson, 0, &errLog))
+	assert.Equal(t, "", errLog.String())
+	actual.Reset()
+	assert.Nil(t, imported.WriteToFile(&actual))
+	assert.Equal(t, expected.String(), actual.String())
+	assert.NotNil(t, db.ExportNDJSON(&ndjson))
+}
+
+func TestNDJSONValidation(t *testing.T) {
+	recList, err := ExtractRecordsFromRawFile("../testdata/testconvert/origin1.txt")
+	assert.Nil(t, err)
+	var b bytes.Buffer
+	assert.Nil(t, WriteRecordsToNDJSON(nil, recList[:1], &b))
+	good := strings.Split(strings.TrimSpace(b.String()), "\n")
+	tampered := strings.Replace(good[1], `"description":"`, `"description":"篡改`, 1)
+	input := strings.Join([]string{
+		good[0],
+		tampered,
+		"{not json",
+		strings.Replace(good[1], `"crc32":"`, `"crc32":"0`, 1),
+		`{"file_name":"a.yinao.txt"}`,
+		good[1],
+	}, "\n")
+
+	records := NewRecords()
+	var errLog bytes.Buffer
+	assert.Nil(t, records.AddNDJSON(strings.NewReader(input), 0, &errLog))
+	assert.Equal(t, 1, records.Len())
+	errs := strings.Split(strings.TrimSpace(errLog.String()), "\n")
+	assert.Equal(t, 4, len(errs))
+	assert.True(t, strings.HasPrefix(errs[0], "第2行：校验码错误"))
+	assert.True(t, strings.HasPrefix(errs[1], "第3行不是合法的JSON"))
+	assert.True(t, strings.HasPrefix(errs[2], "第4行：校验码"))
+	assert.True(t, strings.HasPrefix(errs[3], "第5行中没有记录"))
+
+	// 哈希方案不同的记录不能被导入，头部和加密记录文件中的一样检查
+	err = NewRecordsWithScheme("hmac-sha256").AddNDJSON(strings.NewReader(input), 0, &errLog)
+	assert.NotNil(t, err)
+	err = NewRecords().AddNDJSON(strings.NewReader(`{"header":{"version":99,"hash":"sha256"}}`), 0, &errLog)
+	assert.NotNil(t, err)
+
+	// 没有头部时按版本1处理，记录不能有扩展字段
+	errLog.Reset()
+	records = NewRecords()
+	assert.Nil(t, records.AddNDJSON(strings.NewReader(good[1]+"\n"+strings.Replace(good[1], `}`, `,"incident_date":"2020-05-01"}`, 1)), 0, &errLog))
+	assert.Equal(t, 1, records.Len())
+	assert.Contains(t, errLog.String(), "第2行：版本1的文件中的记录不能有扩展字段")
+	assert.Equal(t, 0, records.normalization)
+}
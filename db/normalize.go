@@ -0,0 +1,142 @@
+package db
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// 本程序在计算哈希值之前，对基本信息和身份证号进行规范化所用的方法的版本，它被写入加密记录文件的头部。
+// 各个版本的规范化方法：
+//  0. 不进行规范化，哈希值是对输入的原文计算的（版本6之前的文件都是如此）
+//  1. NFC规范化，全角字符转为半角，去掉空白字符，逗号统一为中文逗号，繁体字转为简体字，
+//     少数民族姓名中的间隔号统一为“·”，身份证号中的字母统一为大写
+const NormalizationVersion = 1
+
+// 少数民族姓名中的各种间隔号，它们都被统一为“·”（U+00B7）
+var nameDots = map[rune]bool{
+	'.': true, '•': true, '・': true, '‧': true, '∙': true, '⋅': true, '･': true, '．': true,
+}
+
+// 姓名中常见的繁体字和对应的简体字，每两个字符为一组
+const t2sPairs = "" +
+	"張张陳陈劉刘楊杨黃黄趙赵吳吴週周孫孙馬马鄭郑謝谢韓韩馮冯鄧邓蕭萧葉叶蘇苏許许呂吕盧卢蔣蒋賈贾" +
+	"閻阎陸陆龍龙萬万錢钱湯汤譚谭鍾钟顧顾龔龚嚴严賴赖歐欧華华衛卫倫伦鄒邹閔闵龐庞聶聂羅罗魯鲁齊齐" +
+	"國国偉伟強强軍军傑杰濤涛濱滨鵬鹏飛飞麗丽紅红豔艳艷艳鳳凤蘭兰雲云靜静潔洁瑩莹輝辉興兴銘铭錦锦" +
+	"鋒锋鋼钢釗钊東东書书賢贤貴贵寶宝愛爱義义禮礼學学進进達达遠远運运連连長长開开閩闽關关陽阳" +
+	"靈灵韻韵順顺頌颂頤颐穎颖風风飄飘餘余馳驰駿骏騰腾驍骁鳴鸣鴻鸿鶴鹤鷹鹰麥麦齡龄億亿傳传僑侨儀仪" +
+	"優优兒儿兩两凱凯劍剑勁劲勝胜勳勋匯汇區区協协單单員员圓圆團团園园圖图堅坚壯壮壽寿夢梦奮奋嬌娇" +
+	"嬋婵寧宁實实專专層层嶺岭帥帅師师廣广彌弥從从復复懷怀戀恋戰战擁拥曉晓暉晖晉晋會会條条棟栋業业" +
+	"極极榮荣樂乐樹树橋桥機机權权歡欢歲岁歸归氣气漢汉濟济灣湾煒炜燈灯爾尔獻献玨珏現现瑋玮環环璽玺" +
+	"產产畢毕發发盡尽監监盤盘眾众碩硕確确祿禄禎祯種种稱称穩稳競竞筆笔節节範范簡简糧粮紀纪純纯紗纱" +
+	"納纳紹绍經经維维綺绮綿绵緒绪練练縣县總总績绩繼继續续纓缨習习聖圣聞闻聯联聰聪聲声肅肃臺台與与" +
+	"舉举藝艺葦苇蓮莲蔭荫薈荟藍蓝蘆芦處处號号裝装規规視视親亲覺觉觀观訓训記记詩诗誠诚誼谊談谈謙谦" +
+	"譽誉讓让豐丰貞贞財财賓宾賜赐贊赞躍跃軒轩輔辅輪轮轉转農农郵邮鄉乡醫医鈞钧鈺钰銀银錫锡鍵键鎮镇" +
+	"鏡镜鐵铁閣阁隱隐雙双離离韋韦項项領领頡颉顏颜顯显颯飒驗验鯨鲸黨党亞亚倉仓價价儉俭勞劳勵励" +
+	"厲厉嘯啸壇坛奧奥寬宽寫写屬属嶽岳巖岩彥彦憶忆應应揚扬換换攜携斷断樺桦櫻樱瀅滢灝灏煥焕燁烨瑤瑶" +
+	"瓊琼綠绿緣缘繡绣翹翘莊庄萊莱薔蔷蘊蕴詠咏誌志諾诺謹谨識识譯译貝贝賽赛贏赢軾轼遜逊遙遥鈴铃鍇锴" +
+	"鎧铠陣阵隴陇雋隽鞏巩韜韬頂顶顥颢驊骅鵑鹃鶯莺鸞鸾齋斋崢峥嶸嵘巒峦紋纹綸纶繽缤蘋苹璣玑琿珲瑪玛" +
+	"婭娅嫻娴婁娄媽妈姍姗嫵妩孿孪檜桧縱纵蟬蝉鬥斗髮发魚鱼鳥鸟鵝鹅鸝鹂點点齒齿龜龟"
+
+// 繁体字到简体字的映射
+var t2s = func() map[rune]rune {
+	m := make(map[rune]rune)
+	runes := []rune(t2sPairs)
+	for i := 0; i+1 < len(runes); i += 2 {
+		m[runes[i]] = runes[i+1]
+	}
+	return m
+}()
+
+// 按照NormalizationVersion对基本信息进行规范化
+func NormalizeBaseInfo(info string) string {
+	return normalizeBaseInfo(NormalizationVersion, info)
+}
+
+// 按照NormalizationVersion对身份证号进行规范化
+func NormalizeID(id string) string {
+	return normalizeID(NormalizationVersion, id)
+}
+
+// 按照指定版本的方法对基本信息进行规范化，按前缀查询的客户端需要使用服务器上的文件所用的版本
+func NormalizeBaseInfoVersion(version int, info string) string {
+	return normalizeBaseInfo(version, info)
+}
+
+// 按照指定版本的方法对身份证号进行规范化
+func NormalizeIDVersion(version int, id string) string {
+	return normalizeID(version, id)
+}
+
+// 按照指定版本的方法对基本信息进行规范化，版本0不做任何改变
+func normalizeBaseInfo(version int, info string) string {
+	if version == 0 {
+		return info
+	}
+	s := width.Fold.String(norm.NFC.String(info))
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case r == ',' || r == '，':
+			r = '，'
+		case nameDots[r]:
+			r = '·'
+		}
+		if simplified, ok := t2s[r]; ok {
+			r = simplified
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// 按照指定版本的方法对身份证号进行规范化，版本0不做任何改变
+func normalizeID(version int, id string) string {
+	if version == 0 {
+		return id
+	}
+	s := width.Fold.String(norm.NFC.String(id))
+	return strings.ToUpper(strings.Join(strings.Fields(s), ""))
+}
+
+// 查询时输入的信息的各种写法。versions是已载入的各个文件所用的规范化版本，
+// 版本不同的文件中，同一个人的哈希值是对不同的写法计算的。按当前版本规范化之后的写法总是排在最前面
+func normalizedVariants(versions []int, s string, fn func(version int, s string) string) []string {
+	variants := []string{fn(NormalizationVersion, s)}
+	for _, v := range versions {
+		variant := fn(v, s)
+		found := false
+		for _, other := range variants {
+			if other == variant {
+				found = true
+				break
+			}
+		}
+		if !found {
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+// 按基本信息查询时实际使用的各个明文：输入的各种写法，以及它们的出生年份加一和减一之后的结果
+func BaseInfoVariants(versions []int, info string) []string {
+	var infoList []string
+	for _, variant := range normalizedVariants(versions, info, normalizeBaseInfo) {
+		infoList = append(infoList, variant)
+		if strings.Count(variant, "，") == 2 { //没有规范化的原文中可能没有中文逗号，无法调整年份
+			adjacent := BaseInfoToAdjacentYears(variant)
+			infoList = append(infoList, adjacent[0], adjacent[1])
+		}
+	}
+	return infoList
+}
+
+// 按身份证号查询时实际使用的各个明文，即输入的各种写法
+func IDVariants(versions []int, id string) []string {
+	return normalizedVariants(versions, id, normalizeID)
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "张若美，女，2018", NormalizeBaseInfo("张若美，女，2018"))
+	assert.Equal(t, "张若美，女，2018", NormalizeBaseInfo(" 張若美 , 女 ，２０１８\t"))
+	assert.Equal(t, "阿依古丽·买买提，女，1990", NormalizeBaseInfo("阿依古丽•买买提，女，1990"))
+	assert.Equal(t, "阿依古丽·买买提，女，1990", NormalizeBaseInfo("阿依古丽．买买提，女，1990"))
+	assert.Equal(t, "阿依古丽·买买提，女，1990", NormalizeBaseInfo("阿依古丽.买买提，女，1990"))
+	// 组合字符被合成为一个字符
+	assert.Equal(t, "Jos\u00e9，男，1990", NormalizeBaseInfo("Jose\u0301，男，1990"))
+	assert.Equal(t, "11010920180401984X", NormalizeID(" １１０１０９２０１８０４０１９８４ｘ "))
+	assert.Equal(t, "NA", NormalizeID("na"))
+
+	// 繁体字表中的每一组都是不同的两个字，并且简体字不会再被转换
+	for trad, simp := range t2s {
+		assert.NotEqual(t, trad, simp)
+		_, ok := t2s[simp]
+		assert.False(t, ok, string(simp))
+	}
+	assert.Equal(t, []string{"a，b", "a,b"}, normalizedVariants([]int{1, 0}, "a,b", normalizeBaseInfo))
+	assert.Equal(t, []string{"a，b"}, normalizedVariants([]int{1}, "a,b", normalizeBaseInfo))
+}
+
+func TestNormalizationVersions(t *testing.T) {
+	// 旧版本的文件中，哈希值是对输入的原文计算的
+	rec := &Record{
+		BaseInfoHash: SHA256Hasher.Sum("張若美，女，2018"),
+		IDHash:       SHA256Hasher.Sum("11010920180401984X"),
+		Confidence:   90,
+		Description:  "江流宛转绕芳甸，月照花林皆似霰。",
+	}
+	rec.Crc32 = rec.checksum()
+	var b bytes.Buffer
+	err := WriteRecordsToFileWithHeader(&FileHeader{Scheme: SchemeSHA256}, []*Record{rec}, &b)
+	assert.Equal(t, nil, err)
+	assert.False(t, strings.Contains(b.String(), "normalize"))
+	err = ioutil.WriteFile("./old.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll("./old.yinao.txt")
+	convertAndWriteToFile(File1, "./new.yinao.txt")
+	defer os.RemoveAll("./new.yinao.txt")
+
+	db, err := NewDBFromFiles([]string{"./old.yinao.txt", "./new.yinao.txt"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, db.HeaderMap["./old.yinao.txt"].Normalization)
+	assert.Equal(t, NormalizationVersion, db.HeaderMap["./new.yinao.txt"].Normalization)
+	recList, err := db.SearchBaseInfo("張若美，女，2018")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(recList))
+	recList, err = db.SearchBaseInfo("张若美，女，2018")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+	assert.Equal(t, "./new.yinao.txt", recList[0].FileName)
+	_, err = db.PSISet() //版本不同的哈希值无法一起求交集
+	assert.Contains(t, err.Error(), "规范化方法的版本")
+	db.Close()
+
+	// 只合并旧版本的文件时，合并结果也按旧版本查询
+	os.MkdirAll("./a", os.ModePerm)
+	defer os.RemoveAll("./a")
+	os.Rename("./old.yinao.txt", "./a/old.yinao.txt")
+	records := NewRecords()
+	records.AddEncRecordsInDir("./a", 0, os.Stderr)
+	b.Reset()
+	err = records.WriteToFile(&b)
+	assert.Equal(t, nil, err)
+	assert.False(t, strings.Contains(b.String(), "normalize"))
+
+	// 规范化方法的版本不同的文件不能合并在一起
+	err = records.AddEncRecordsInFile("./new.yinao.txt", 0, os.Stderr)
+	assert.Contains(t, err.Error(), "规范化方法的版本")
+	assert.Equal(t, 1, records.Len())
+	records = NewRecords()
+	err = records.AddEncRecordsInFile("./new.yinao.txt", 0, os.Stderr)
+	assert.Equal(t, nil, err)
+	err = records.AddEncRecordsInFile("./a/old.yinao.txt", 0, os.Stderr)
+	assert.Contains(t, err.Error(), "规范化方法的版本")
+
+	_, err = parseHeader([]string{FileMagic, "version: 5", "hash: sha256", "normalize: 1"})
+	assert.Contains(t, err.Error(), "不能有normalize字段")
+	_, err = parseHeader([]string{FileMagic, "version: 6", "hash: sha256", "normalize: 2"})
+	assert.Contains(t, err.Error(), "请升级本程序")
+}
@@ -0,0 +1,331 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	psiMagic    = "YINAOPSI" // 隐私集合求交时双方最先发送的8个字节
+	psiVersion  = 1          // 隐私集合求交协议的版本
+	psiDomain   = "YinaoBlacklist PSI point\x00"
+	maxPSIItems = 1 << 24 // 对方最多可以发送的哈希值个数
+
+	psiKindBaseInfo = 0 // 哈希值是BaseInfoHash
+	psiKindID       = 1 // 哈希值是IDHash
+)
+
+// 参与隐私集合求交的一方所持有的哈希值。撤回记录、已被撤回的记录，以及身份证号为NA的IDHash都不在其中
+type PSISet struct {
+	Header   FileHeader          // 计算哈希值所用的哈希方案和规范化方法，双方的哈希方案和规范化方法的版本都必须相同
+	BaseInfo [][sha256.Size]byte // 各条记录的BaseInfoHash，已排序，没有重复
+	ID       [][sha256.Size]byte // 各条记录的IDHash，已排序，没有重复
+}
+
+// 排序并且去掉重复的哈希值
+func sortHashes(list [][sha256.Size]byte) [][sha256.Size]byte {
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i][:], list[j][:]) < 0
+	})
+	res := list[:0]
+	for i, h := range list {
+		if i == 0 || h != list[i-1] {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// 用各条记录生成参与求交的哈希值，secret是群组密钥，用于在带密钥的哈希方案中找出身份证号为NA的记录，不需要时可以为nil
+func (recs *Records) PSISet(secret []byte) (*PSISet, error) {
+	set := &PSISet{Header: FileHeader{Version: FormatVersion, Scheme: recs.scheme, Normalization: recs.normalization}}
+	recList := recs.sorted()
+	if len(recList) == 0 {
+		return set, nil
+	}
+	hasher, err := ParseHasher(recs.scheme, secret)
+	if err != nil {
+		return nil, err
+	}
+	shaNA := hasher.Sum("NA")
+	for _, rec := range recList {
+		if rec.IsTombstone() {
+			continue
+		}
+		set.BaseInfo = append(set.BaseInfo, rec.BaseInfoHash)
+		if rec.IDHash != shaNA {
+			set.ID = append(set.ID, rec.IDHash)
+		}
+	}
+	set.BaseInfo, set.ID = sortHashes(set.BaseInfo), sortHashes(set.ID)
+	return set, nil
+}
+
+// 用数据库中的记录生成参与求交的哈希值，载入的文件必须使用同一种哈希方案和同一个规范化方法的版本
+func (db *DB) PSISet() (*PSISet, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, fmt.Errorf("数据库已经关闭")
+	}
+	if len(db.hashers) > 1 {
+		return nil, fmt.Errorf("载入的文件使用了多种哈希方案，无法求交集")
+	}
+	set := &PSISet{Header: FileHeader{Version: FormatVersion, Scheme: SchemeSHA256, Normalization: NormalizationVersion}}
+	if len(db.hashers) != 0 {
+		set.Header.Scheme = db.hashers[0].Scheme()
+	}
+	// 不同版本的哈希值混在一起时，只有与对方版本相同的那部分能求出交集，其他的永远不会匹配
+	if len(db.versions) > 1 {
+		return nil, fmt.Errorf("载入的文件使用了多个规范化方法的版本，无法求交集")
+	}
+	if len(db.versions) != 0 {
+		set.Header.Normalization = db.versions[0]
+	}
+	checked := make(map[string]bool)
+	collect := func(m PositionMap, hash func(rec *Record) [sha256.Size]byte) ([][sha256.Size]byte, error) {
+		var res [][sha256.Size]byte
+		for _, posList := range m {
+			for _, pos := range posList {
+				if !checked[pos.FileName] {
+					if err := db.checkFile(pos.FileName); err != nil {
+						return nil, err
+					}
+					checked[pos.FileName] = true
+				}
+				rec, err := db.readRecord(pos)
+				if err != nil {
+					return nil, err
+				}
+				if !db.tombs.retracts(&rec.Record) {
+					res = append(res, hash(&rec.Record))
+				}
+			}
+		}
+		return sortHashes(res), nil
+	}
+	var err error
+	if set.BaseInfo, err = collect(db.BaseInfoMap, func(rec *Record) [sha256.Size]byte { return rec.BaseInfoHash }); err != nil {
+		return nil, err
+	}
+	if set.ID, err = collect(db.IDMap, func(rec *Record) [sha256.Size]byte { return rec.IDHash }); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// 查询数据库中哈希值在set中的记录，例如求交集之后，查看本方的哪些记录在交集中。同时被两种哈希值查询到的记录只返回一次
+func (db *DB) QueryPSISet(set *PSISet) ([]*RecordInFile, error) {
+	var res []*RecordInFile
+	for _, hash := range set.BaseInfo {
+		recList, err := db.QueryBaseInfo(hash)
+		if err != nil {
+			return nil, err
+		}
+		res = appendUnique(res, recList)
+	}
+	for _, hash := range set.ID {
+		recList, err := db.QueryID(hash)
+		if err != nil {
+			return nil, err
+		}
+		res = appendUnique(res, recList)
+	}
+	return res, nil
+}
+
+// 将哈希值映射为Curve25519上的一个点，kind使BaseInfoHash和IDHash映射到不同的点
+func psiPoint(kind byte, hash [sha256.Size]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(psiDomain))
+	h.Write([]byte{kind})
+	h.Write(hash[:])
+	p := h.Sum(nil)
+	p[31] &= 0x7f
+	return p
+}
+
+// 参与求交的一个哈希值
+type psiItem struct {
+	kind   byte
+	hash   [sha256.Size]byte
+	masked []byte // 用本方的私钥加密之后的点
+}
+
+// 写入变长整数表示的个数，以及各个32字节的点
+func writePSIPoints(points [][]byte) []byte {
+	var w binWriter
+	w.uvarint(uint64(len(points)))
+	for _, p := range points {
+		w.Write(p)
+	}
+	return w.Bytes()
+}
+
+// 读取writePSIPoints写入的各个点
+func readPSIPoints(r binReader) ([][]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxPSIItems {
+		return nil, fmt.Errorf("对方发送的哈希值太多了：%d", n)
+	}
+	// 个数是对方发来的，不能按它预先分配内存，否则只发一个很大的个数就能占用几百MB的内存
+	c := n
+	if c > 1024 {
+		c = 1024
+	}
+	points := make([][]byte, 0, c)
+	for i := uint64(0); i < n; i++ {
+		p := make([]byte, curve25519.PointSize)
+		if _, err := io.ReadFull(r, p); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// 向对方发送data，同时接收对方的数据，以免双方都在发送时互相等待。
+// 接收出错时立即返回，发送数据的goroutine会在调用者关闭连接之后退出
+func psiExchange(w io.Writer, data []byte, read func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := w.Write(data)
+		errc <- err
+	}()
+	if err := read(); err != nil {
+		return err
+	}
+	return <-errc
+}
+
+// 与对方进行隐私集合求交（基于Curve25519上的Diffie-Hellman），返回双方共有的哈希值。
+// 双方各自用随机的私钥加密自己的哈希值并发给对方，再用私钥加密对方发来的点并发回去，
+// 两次加密的结果与顺序无关，所以双方都能找出共有的哈希值，但都无法得知对方的其他哈希值，只能得知它们的个数。
+// conn通常是一个TCP连接，双方执行相同的步骤，没有客户端和服务器之分
+func RunPSI(conn io.ReadWriter, set *PSISet) (*PSISet, error) {
+	var key [curve25519.ScalarSize]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return nil, err
+	}
+	items := make([]psiItem, 0, len(set.BaseInfo)+len(set.ID))
+	for _, hash := range set.BaseInfo {
+		items = append(items, psiItem{kind: psiKindBaseInfo, hash: hash})
+	}
+	for _, hash := range set.ID {
+		items = append(items, psiItem{kind: psiKindID, hash: hash})
+	}
+	for i := range items {
+		var err error
+		if items[i].masked, err = curve25519.X25519(key[:], psiPoint(items[i].kind, items[i].hash)); err != nil {
+			return nil, err
+		}
+	}
+	// 按加密之后的值排序，对方无法从顺序中得知任何信息
+	sort.Slice(items, func(i, j int) bool {
+		return bytes.Compare(items[i].masked, items[j].masked) < 0
+	})
+	r := bufio.NewReader(conn)
+
+	// 1. 交换协议的版本和双方的文件头部，检查双方的哈希方案和规范化方法的版本是否相同
+	var w binWriter
+	w.WriteString(psiMagic)
+	binary.BigEndian.PutUint16(w.tmp[:2], psiVersion)
+	w.Write(w.tmp[:2])
+	w.bytes([]byte(strings.Join(set.Header.ToLines(), "\n")))
+	var peerHdr *FileHeader
+	err := psiExchange(conn, w.Bytes(), func() error {
+		var buf [len(psiMagic) + 2]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return err
+		}
+		if string(buf[:len(psiMagic)]) != psiMagic {
+			return fmt.Errorf("对方不是医闹黑名单的隐私集合求交程序")
+		}
+		if v := binary.BigEndian.Uint16(buf[len(psiMagic):]); v != psiVersion {
+			return fmt.Errorf("对方所使用的协议版本%d与本程序所使用的版本%d不同", v, psiVersion)
+		}
+		hdrText, err := readBinBytes(r, 4096)
+		if err != nil {
+			return err
+		}
+		lines := strings.Split(string(hdrText), "\n")
+		if !isHeader(lines) {
+			return fmt.Errorf("对方发送的文件头部的格式错误")
+		}
+		peerHdr, err = parseHeader(lines)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if peerHdr.Scheme != set.Header.Scheme {
+		return nil, fmt.Errorf("对方使用的哈希方案%s与本方的哈希方案%s不同，无法求交集", peerHdr.Scheme, set.Header.Scheme)
+	}
+	if peerHdr.Normalization != set.Header.Normalization {
+		return nil, fmt.Errorf("对方使用的规范化方法的版本%d与本方的版本%d不同，无法求交集", peerHdr.Normalization, set.Header.Normalization)
+	}
+
+	// 2. 交换用各自的私钥加密之后的点
+	masked := make([][]byte, len(items))
+	for i := range items {
+		masked[i] = items[i].masked
+	}
+	var peerMasked [][]byte
+	err = psiExchange(conn, writePSIPoints(masked), func() error {
+		var err error
+		peerMasked, err = readPSIPoints(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 用本方的私钥再次加密对方的点，按原来的顺序发回去，同时接收被对方再次加密的本方的点
+	doubled := make([][]byte, len(peerMasked))
+	peerSet := make(map[string]bool, len(peerMasked))
+	for i, p := range peerMasked {
+		if doubled[i], err = curve25519.X25519(key[:], p); err != nil {
+			return nil, fmt.Errorf("对方发送的数据有误：%s", err.Error())
+		}
+		peerSet[string(doubled[i])] = true
+	}
+	var ownDoubled [][]byte
+	err = psiExchange(conn, writePSIPoints(doubled), func() error {
+		var err error
+		ownDoubled, err = readPSIPoints(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ownDoubled) != len(items) {
+		return nil, fmt.Errorf("对方发回的哈希值个数%d与本方发送的个数%d不同", len(ownDoubled), len(items))
+	}
+
+	// 4. 两次加密之后的值相同，说明哈希值相同
+	res := &PSISet{Header: set.Header}
+	for i, item := range items {
+		if !peerSet[string(ownDoubled[i])] {
+			continue
+		}
+		if item.kind == psiKindBaseInfo {
+			res.BaseInfo = append(res.BaseInfo, item.hash)
+		} else {
+			res.ID = append(res.ID, item.hash)
+		}
+	}
+	res.BaseInfo, res.ID = sortHashes(res.BaseInfo), sortHashes(res.ID)
+	return res, nil
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/curve25519"
+)
+
+// 从原始记录文件的内容生成一方所持有的记录
+func psiRecords(t *testing.T, content string) *Records {
+	err := ioutil.WriteFile("./in.txt", []byte(content), 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./in.txt")
+	recList, err := ExtractRecordsFromRawFile("./in.txt")
+	assert.Nil(t, err)
+	records := NewRecords()
+	for _, rec := range recList {
+		records.Add(*rec, 0)
+	}
+	return records
+}
+
+// 通过本机的TCP连接，让双方进行隐私集合求交
+func runLoopbackPSI(t *testing.T, a, b *PSISet) (*PSISet, *PSISet, error, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	type result struct {
+		set *PSISet
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+		defer conn.Close()
+		set, err := RunPSI(conn, b)
+		done <- result{set, err}
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err)
+	resA, errA := RunPSI(conn, a)
+	conn.Close()
+	res := <-done
+	return resA, res.set, errA, res.err
+}
+
+func TestPSI(t *testing.T) {
+	hospitalA := psiRecords(t, File1)
+	hospitalB := psiRecords(t, File2+"\n"+File3)
+	setA, err := hospitalA.PSISet(nil)
+	assert.Nil(t, err)
+	setB, err := hospitalB.PSISet(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(setA.BaseInfo))
+	assert.Equal(t, 2, len(setA.ID))
+	assert.Equal(t, 5, len(setB.BaseInfo))
+	assert.Equal(t, 3, len(setB.ID)) //身份证号为NA的记录不参与求交
+
+	resA, resB, errA, errB := runLoopbackPSI(t, setA, setB)
+	assert.Nil(t, errA)
+	assert.Nil(t, errB)
+	assert.Equal(t, resA, &PSISet{Header: setA.Header, BaseInfo: setA.BaseInfo, ID: setA.ID})
+	assert.Equal(t, resA.BaseInfo, resB.BaseInfo)
+	assert.Equal(t, resA.ID, resB.ID)
+
+	// 撤回之后，被撤回的记录不再参与求交
+	priv, _ := GenerateSigningKey()
+	tombstoned := psiRecords(t, File2+"\n"+File3)
+	recList := tombstoned.sorted()
+	for _, rec := range recList {
+		if rec.Description == "江流宛转绕芳甸，月照花林皆似霰。\\n空里流霜不觉飞，汀上白沙看不见。" {
+			rec.Sign(priv) //只有带签名的记录才能被撤回
+			tomb := NewTombstone(rec, "")
+			tomb.Sign(priv)
+			tombstoned.Add(*tomb, 0)
+		}
+	}
+	setB, err = tombstoned.PSISet(nil)
+	assert.Nil(t, err)
+	resA, _, errA, errB = runLoopbackPSI(t, setA, setB)
+	assert.Nil(t, errA)
+	assert.Nil(t, errB)
+	assert.Equal(t, 1, len(resA.BaseInfo))
+	assert.Equal(t, 1, len(resA.ID))
+
+	// 与数据库中的记录求交，得到相同的结果，并且可以查到本方在交集中的记录
+	var b bytes.Buffer
+	assert.Nil(t, hospitalB.WriteToFile(&b))
+	err = ioutil.WriteFile("./psi.yinao.txt", b.Bytes(), 0644)
+	assert.Nil(t, err)
+	defer os.RemoveAll("./psi.yinao.txt")
+	yinaoDB, err := NewDBFromFiles([]string{"./psi.yinao.txt"})
+	assert.Nil(t, err)
+	defer yinaoDB.Close()
+	setB, err = yinaoDB.PSISet()
+	assert.Nil(t, err)
+	expected, err := hospitalB.PSISet(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, setB)
+	_, resB, _, errB = runLoopbackPSI(t, setA, setB)
+	assert.Nil(t, errB)
+	recs, err := yinaoDB.QueryPSISet(resB)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(recs)) //张若虚、张若（身份证号相同）和张若美的记录
+
+	// 哈希方案不同时无法求交集
+	setC, err := NewRecordsWithScheme(SchemeHMACSHA256 + "/abc").PSISet(nil)
+	assert.Nil(t, err)
+	_, _, errA, errB = runLoopbackPSI(t, setA, setC)
+	assert.NotNil(t, errA)
+	assert.NotNil(t, errB)
+
+	// 规范化方法的版本不同时也无法求交集，否则交集会少了许多记录
+	setD := &PSISet{Header: setA.Header, BaseInfo: setA.BaseInfo, ID: setA.ID}
+	setD.Header.Normalization = 0
+	_, _, errA, errB = runLoopbackPSI(t, setA, setD)
+	assert.Contains(t, errA.Error(), "规范化方法的版本")
+	assert.Contains(t, errB.Error(), "规范化方法的版本")
+}
+
+func TestReadPSIPoints(t *testing.T) {
+	var w binWriter
+	w.uvarint(maxPSIItems) //对方声称要发送很多点，实际上只发送了两个
+	w.Write(make([]byte, 2*curve25519.PointSize))
+	_, err := readPSIPoints(bytes.NewReader(w.Bytes()))
+	assert.NotNil(t, err)
+	w = binWriter{}
+	w.uvarint(maxPSIItems + 1)
+	_, err = readPSIPoints(bytes.NewReader(w.Bytes()))
+	assert.Contains(t, err.Error(), "太多")
+	points, err := readPSIPoints(bytes.NewReader(writePSIPoints([][]byte{make([]byte, curve25519.PointSize)})))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(points))
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// 从记录文件中逐条读取记录，同时记录每条记录在文件中开始的字节位置。
+// 行尾可以是\n、\r\n或者\r，一行的长度没有限制
+type recordReader struct {
+	r      *bufio.Reader
+	offset int64  // 下一个要读取的字节在文件中的位置
+	line   []byte // 正在读取的一行，重复使用以减少内存分配
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	return &recordReader{r: bufio.NewReader(r)}
+}
+
+// 读取一行，返回去掉行尾之后的内容和这一行开始的位置。已经读完时返回io.EOF
+func (rr *recordReader) readLine() (string, int64, error) {
+	start := rr.offset
+	rr.line = rr.line[:0]
+	for {
+		c, err := rr.r.ReadByte()
+		if err == io.EOF && rr.offset > start { //最后一行没有行尾
+			return string(rr.line), start, nil
+		}
+		if err != nil {
+			return "", start, err
+		}
+		rr.offset++
+		switch c {
+		case '\n':
+			return string(rr.line), start, nil
+		case '\r':
+			if next, err := rr.r.Peek(1); err == nil && next[0] == '\n' {
+				rr.r.ReadByte()
+				rr.offset++
+			}
+			return string(rr.line), start, nil
+		}
+		rr.line = append(rr.line, c)
+	}
+}
+
+// 读取下一条记录，返回记录的各行（已去掉首尾的空白字符）和记录开始的位置。
+// 记录之间用空行隔开，连续的空行被当作一个。没有更多的记录时返回io.EOF
+func (rr *recordReader) next() ([]string, int64, error) {
+	recLines := make([]string, 0, 8)
+	start := int64(0)
+	for {
+		line, off, err := rr.readLine()
+		if err == io.EOF && len(recLines) != 0 {
+			return recLines, start, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 { //空行标志着一条记录的结束
+			if len(recLines) == 0 {
+				continue
+			}
+			return recLines, start, nil
+		}
+		if len(recLines) == 0 {
+			start = off
+		}
+		recLines = append(recLines, line)
+	}
+}
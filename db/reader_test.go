@@ -0,0 +1,60 @@
+package db
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReader(t *testing.T) {
+	long := strings.Repeat("月", 40000) //超过bufio.Scanner默认的64KB
+	data := "\r\n\r\na1\r\n a2 \r\n\r\n\n\nb1\rb2\r\rc1\n" + long + "\nc3"
+	rr := newRecordReader(strings.NewReader(data))
+	expected := [][]string{{"a1", "a2"}, {"b1", "b2"}, {"c1", long, "c3"}}
+	for _, lines := range expected {
+		recLines, off, err := rr.next()
+		assert.Nil(t, err)
+		assert.Equal(t, lines, recLines)
+		assert.True(t, strings.HasPrefix(data[off:], lines[0]))
+	}
+	_, _, err := rr.next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLineEndings(t *testing.T) {
+	long := strings.Repeat("海上明月共潮生。", 10000)
+	raw := File1 + "\n\n张若虚，男，1999\n11010919990401881X\n50.0\n" + long
+	err := ioutil.WriteFile("./in.txt", []byte(raw), 0644)
+	assert.Nil(t, err)
+	recList, err := ExtractRecordsFromRawFile("./in.txt")
+	assert.Nil(t, err)
+	os.RemoveAll("./in.txt")
+	var b bytes.Buffer
+	err = WriteRecordsToFile(recList, &b)
+	assert.Nil(t, err)
+
+	// 用Windows的行尾保存的文件，载入和读取记录的结果都与原来的相同
+	for _, useIndex := range []bool{false, true} {
+		err = ioutil.WriteFile("./crlf.yinao.txt", bytes.ReplaceAll(b.Bytes(), []byte("\n"), []byte("\r\n")), 0644)
+		assert.Nil(t, err)
+		db, err := NewDBFromFilesWithOptions([]string{"./crlf.yinao.txt"}, &LoadOptions{UseIndex: useIndex})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, db.Len())
+		res, err := db.SearchID("11010920180401984X")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(res))
+		assert.Equal(t, "江流宛转绕芳甸，月照花林皆似霰。\\n空里流霜不觉飞，汀上白沙看不见。", res[0].Description)
+		res, err = db.SearchID("11010919990401881X")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(res))
+		assert.Equal(t, long, res[0].Description)
+		db.Close()
+	}
+	os.RemoveAll("./crlf.yinao.txt")
+	os.RemoveAll("./crlf.yinao.txt" + IndexFileSuffix)
+}
@@ -1,16 +1,18 @@
 package db
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // 一条医闹记录
@@ -19,69 +21,162 @@ type Record struct {
 	IDHash       [sha256.Size]byte // 身份证号码的哈希值
 	Confidence   float32           // 置信参数
 	Description  string            // 对医闹行为的描述
-	Crc32        uint32            // 用BaseInfoHash, IDHash, Description生成的校验码
+	Crc32        uint32            // 用BaseInfoHash, IDHash, Description生成的校验码，不包括日期等扩展字段
+
+	Signer    [ed25519.PublicKeySize]byte // 签名者（贡献者）的公钥，全为0时表示记录没有签名
+	Signature [ed25519.SignatureSize]byte // 签名者对BaseInfoHash, IDHash, Description, IncidentDate, PublishDate和Retract的签名，不包括Confidence
+
+	Retract [sha256.Size]byte // 被撤回的记录的指纹，全为0时表示这是一条普通记录，否则是一条撤回记录
+
+	IncidentDate time.Time // 医闹事件发生的日期，零值表示未知
+	PublishDate  time.Time // 记录被发布（转换为加密记录）的日期，零值表示未知
 }
 
 func NewRecord(baseInfo string, id string, confidence float32, description string) *Record {
+	return NewRecordWithHasher(SHA256Hasher, baseInfo, id, confidence, description)
+}
+
+// 使用指定的哈希方法创建一条记录，基本信息和身份证号会先按照NormalizationVersion进行规范化
+func NewRecordWithHasher(h Hasher, baseInfo string, id string, confidence float32, description string) *Record {
 	rec := &Record{
-		BaseInfoHash: sha256.Sum256([]byte(baseInfo)),
-		IDHash:       sha256.Sum256([]byte(id)),
+		BaseInfoHash: h.Sum(NormalizeBaseInfo(baseInfo)),
+		IDHash:       h.Sum(NormalizeID(id)),
 		Confidence:   confidence,
 		Description:  description,
 	}
+	rec.Crc32 = rec.checksum()
+	return rec
+}
+
+// 计算此条记录的校验码
+func (rec *Record) checksum() uint32 {
 	h := crc32.NewIEEE()
 	h.Write(rec.BaseInfoHash[:])
 	h.Write(rec.IDHash[:])
 	h.Write([]byte(rec.Description))
-	rec.Crc32 = h.Sum32()
-	return rec
+	return h.Sum32()
 }
 
 // 得到此条记录的校验码
 func (rec *Record) VerifyChecksum() bool {
-	h := crc32.NewIEEE()
-	h.Write(rec.BaseInfoHash[:])
-	h.Write(rec.IDHash[:])
-	h.Write([]byte(rec.Description))
-	return h.Sum32() == rec.Crc32
+	return rec.checksum() == rec.Crc32
 }
 
-// 将记录转为5行纯文本
+// 将记录转为5行纯文本，如果有扩展字段，则在其后增加若干扩展行
 func (rec *Record) ToLines() []string {
-	var lines [5]string
+	lines := make([]string, 5, 9)
 	lines[0] = base64.StdEncoding.EncodeToString(rec.BaseInfoHash[:])
 	lines[1] = base64.StdEncoding.EncodeToString(rec.IDHash[:])
 	lines[2] = fmt.Sprintf("%f", rec.Confidence)
 	lines[3] = rec.Description
 	lines[4] = fmt.Sprintf("%08x", rec.Crc32)
-	return lines[:]
+	if !rec.IncidentDate.IsZero() {
+		lines = append(lines, "date: "+rec.IncidentDate.Format(DateLayout))
+	}
+	if !rec.PublishDate.IsZero() {
+		lines = append(lines, "published: "+rec.PublishDate.Format(DateLayout))
+	}
+	if rec.IsTombstone() {
+		lines = append(lines, "retract: "+base64.StdEncoding.EncodeToString(rec.Retract[:]))
+	}
+	if rec.IsSigned() {
+		lines = append(lines, "sig: "+base64.StdEncoding.EncodeToString(rec.Signer[:])+
+			" "+base64.StdEncoding.EncodeToString(rec.Signature[:]))
+	}
+	return lines
 }
 
-func WriteRecordsToFile(recList []*Record, file io.Writer) (err error) {
-	for _, rec := range recList {
-		for _, line := range rec.ToLines() {
-			_, err = file.Write([]byte(line))
-			if err != nil {
-				return
-			}
-			_, err = file.Write([]byte("\n"))
-			if err != nil {
-				return
-			}
+// 解析一个扩展行，其格式为“键: 值”
+func (rec *Record) parseExtension(line string) error {
+	kv := strings.SplitN(line, ":", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("扩展行的格式错误：%s", line)
+	}
+	value := strings.TrimSpace(kv[1])
+	switch strings.TrimSpace(kv[0]) {
+	case "sig": //签名者的公钥和签名，用空格隔开
+		parts := strings.Fields(value)
+		if len(parts) != 2 {
+			return fmt.Errorf("签名的格式错误：%s", line)
+		}
+		pub, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil || len(pub) != len(rec.Signer) {
+			return fmt.Errorf("签名的格式错误：%s", line)
+		}
+		sig, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(sig) != len(rec.Signature) {
+			return fmt.Errorf("签名的格式错误：%s", line)
+		}
+		copy(rec.Signer[:], pub)
+		copy(rec.Signature[:], sig)
+	case "date": //医闹事件发生的日期
+		t, err := ParseDate(value)
+		if err != nil {
+			return err
+		}
+		rec.IncidentDate = t
+	case "published": //记录被发布的日期
+		t, err := ParseDate(value)
+		if err != nil {
+			return err
+		}
+		rec.PublishDate = t
+	case "retract": //被撤回的记录的指纹
+		fp, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(fp) != len(rec.Retract) {
+			return fmt.Errorf("撤回记录的格式错误：%s", line)
+		}
+		copy(rec.Retract[:], fp)
+	default:
+		return fmt.Errorf("未知的扩展字段：%s", line)
+	}
+	return nil
+}
+
+// 将若干行纯文本写入文件，并以一个空行结束
+func writeLines(lines []string, file io.Writer) (err error) {
+	for _, line := range lines {
+		_, err = file.Write([]byte(line))
+		if err != nil {
+			return
 		}
 		_, err = file.Write([]byte("\n"))
 		if err != nil {
 			return
 		}
 	}
+	_, err = file.Write([]byte("\n"))
 	return
 }
 
-// rec和other是同一条医闹记录（它们只有置信参数不同）
+func WriteRecordsToFile(recList []*Record, file io.Writer) error {
+	return WriteRecordsToFileWithHeader(nil, recList, file)
+}
+
+// 先写入文件头部，再将记录写入文件，hdr为nil时写入使用sha256哈希方案和当前规范化方法的头部
+func WriteRecordsToFileWithHeader(hdr *FileHeader, recList []*Record, file io.Writer) error {
+	if hdr == nil {
+		hdr = &FileHeader{Scheme: SchemeSHA256, Normalization: NormalizationVersion}
+	}
+	if err := writeLines(hdr.ToLines(), file); err != nil {
+		return err
+	}
+	for _, rec := range recList {
+		if err := writeLines(rec.ToLines(), file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rec和other是同一个人发布的同一条医闹记录（它们只有置信参数和发布日期不同）
 func (rec *Record) IsSame(other Record) bool {
 	return bytes.Equal(rec.BaseInfoHash[:], other.BaseInfoHash[:]) &&
 		bytes.Equal(rec.IDHash[:], other.IDHash[:]) &&
-		rec.Description == other.Description
+		rec.Description == other.Description &&
+		rec.Signer == other.Signer &&
+		rec.Retract == other.Retract &&
+		rec.IncidentDate.Equal(other.IncidentDate)
 }
 
 // 将基本信息中的年份减一和加一，形成两个新的基本信息
@@ -94,9 +189,12 @@ func BaseInfoToAdjacentYears(info string) [2]string {
 	}
 }
 
-// 检查基本信息的输入是否有误
+// 最早的出生年份，基本信息和身份证号中的出生年份都不能早于它，以免从身份证号生成的基本信息无法通过检查
+const minBirthYear = 1912
+
+// 检查基本信息的输入是否有误，检查之前会先进行规范化
 func CheckBaseInfo(info string) error {
-	parts := strings.Split(info, "，")
+	parts := strings.Split(NormalizeBaseInfo(info), "，")
 	if len(parts) != 3 {
 		return fmt.Errorf("基本信息的格式是：姓名，性别，出生年份。注意中间要用两个中文逗号隔开。错误输入%s", info)
 	}
@@ -107,7 +205,7 @@ func CheckBaseInfo(info string) error {
 	if err != nil {
 		return fmt.Errorf("%s 无法被转为一个年份。", parts[2])
 	}
-	if year <= 1911 {
+	if year < minBirthYear {
 		return fmt.Errorf("出生年份 %s 太小了。", info)
 	}
 	if year >= 2051 {
@@ -116,30 +214,6 @@ func CheckBaseInfo(info string) error {
 	return nil
 }
 
-// 检查身份证号的输入是否有误
-func CheckID(id string) error {
-	if id == "NA" {
-		return nil
-	}
-	runes := []rune(id)
-	if len(runes) != 18 {
-		return fmt.Errorf("身份证号 %s 不是18位。", id)
-	}
-	last := len(runes) - 1
-	for _, r := range runes[:last] {
-		if '0' <= r && r <= '9' {
-			continue
-		}
-		return fmt.Errorf("身份证号 %s 格式错误，非法字符：%s", id, string(r))
-	}
-	r := runes[last]
-	if '0' <= r && r <= '9' || 'X' == r {
-		return nil
-	} else {
-		return fmt.Errorf("身份证号 %s 格式错误，最后一个字符必须是数字0～9或者字母X", id)
-	}
-}
-
 // 解析置信参数
 func parseConfidence(conf string) (float32, error) {
 	s, err := strconv.ParseFloat(conf, 32)
@@ -155,78 +229,174 @@ func parseConfidence(conf string) (float32, error) {
 	return float32(s), nil
 }
 
+// 将原始记录转为加密记录时所使用的选项
+type ConvertOptions struct {
+	Hasher             Hasher // 计算哈希值的方法，为nil时使用sha256
+	Creator            string // 写入文件头部的创建者，可以为空
+	EncryptDescription bool   // 是否加密对医闹行为的描述，加密后只有知道患者身份的人才能看到描述
+
+	SigningKey  ed25519.PrivateKey // 贡献者的签名私钥，不为nil时对每条记录签名
+	PublishDate time.Time          // 写入每条记录的发布日期，零值表示不写入
+	FillFromID  bool               // 基本信息中缺少性别或者出生年份时，是否用身份证号补全
+	Encoding    string             // 原始记录文件的编码，为空时自动识别，见DecodeText
+}
+
+func (opts *ConvertOptions) hasher() Hasher {
+	if opts == nil || opts.Hasher == nil {
+		return SHA256Hasher
+	}
+	return opts.Hasher
+}
+
+// 转换后的加密记录文件所使用的头部
+func (opts *ConvertOptions) Header() *FileHeader {
+	hdr := &FileHeader{Scheme: opts.hasher().Scheme(), Normalization: NormalizationVersion}
+	if opts != nil {
+		hdr.Creator = opts.Creator
+	}
+	return hdr
+}
+
 // 将若干行的原始医闹记录，转换为一个Record
-func parseRawLines(recLines []string) (*Record, error) {
+func parseRawLines(recLines []string, opts *ConvertOptions) (*Record, error) {
 	if len(recLines) < 4 {
 		return nil, fmt.Errorf("记录太短了，必须至少有四行：%s", strings.Join(recLines, "\n"))
 	}
 	//第一行是患者基本信息（姓名，性别，出生年份），用中文逗号隔开
-	err := CheckBaseInfo(recLines[0])
+	info, id := NormalizeBaseInfo(recLines[0]), NormalizeID(recLines[1])
+	if opts != nil && opts.FillFromID {
+		info = FillBaseInfoFromID(info, id)
+	}
+	err := CheckBaseInfo(info)
 	if err != nil {
 		return nil, err
 	}
 	//第二行是患者的身份证号，如果无法提供则以NA代替
-	err = CheckID(recLines[1])
+	err = CheckID(id)
 	if err != nil {
 		return nil, err
 	}
+	//身份证号中已经包含了性别和出生日期，它们必须与基本信息一致
+	if err = CheckBaseInfoWithID(info, id); err != nil {
+		return nil, err
+	}
 	//第三行是置信指数，它是一个百分数，最大为100，最小为0，
 	conf, err := parseConfidence(recLines[2])
 	if err != nil {
 		return nil, err
 	}
+	//第四行可以是医闹事件发生的日期，格式为“日期：2020-05-01”
+	var incident time.Time
+	descLines := recLines[3:]
+	if date, ok := cutDatePrefix(descLines[0]); ok {
+		if incident, err = ParseDate(date); err != nil {
+			return nil, err
+		}
+		descLines = descLines[1:]
+		if len(descLines) == 0 {
+			return nil, fmt.Errorf("记录中没有描述：%s", strings.Join(recLines, "\n"))
+		}
+	}
 	//其他行是对于患者医闹记录的文本描述
-	description := strings.Join(recLines[3:], "\\n")
-	return NewRecord(recLines[0], recLines[1], conf, description), nil
+	description := strings.Join(descLines, "\\n")
+	rec := NewRecordWithHasher(opts.hasher(), info, id, conf, description)
+	rec.IncidentDate = incident
+	if opts != nil {
+		rec.PublishDate = truncateToDate(opts.PublishDate)
+	}
+	if opts != nil && opts.EncryptDescription {
+		if err := rec.EncryptDescription(opts.hasher(), info, id); err != nil {
+			return nil, err
+		}
+	}
+	if opts != nil && opts.SigningKey != nil {
+		rec.Sign(opts.SigningKey)
+	}
+	return rec, nil
+}
+
+// 从r中读取医闹记录，off是每条记录在r中开始的位置
+func extractRecords(r io.Reader, fn func(recLines []string, off int64) error) error {
+	rr := newRecordReader(r)
+	for {
+		recLines, off, err := rr.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(recLines, off); err != nil {
+			return err
+		}
+	}
 }
 
-// 从文本文件中读取医闹记录，并且将它们转换为Record列表
-// fn用来解析记录的文本，根据读取的记录的类型（原始的还是加密的），可采用不同的fn
-func extractRecordsFromFile(fname string, fn func(recLines []string, off int64) error) error {
+// 从加密记录文件中读取医闹记录，文件的头部会被解析出来，和每条记录一起交给fn处理，最后被返回
+// 格式有误的记录会被跳过，错误信息写入errLog
+func extractEncRecordsFromFile(fname string, errLog io.Writer, fn func(hdr *FileHeader, rec *Record, off int64) error) (*FileHeader, error) {
 	file, err := os.Open(fname)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
+	if strings.HasSuffix(fname, BinFileSuffix) {
+		return extractBinRecords(file, fname, errLog, fn)
+	}
+	return extractEncRecords(file, fname, errLog, fn)
+}
 
-	recLines := make([]string, 0, 20)
-	offset := int64(0)
-	start := int64(0)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(recLines) == 0 { //一条记录的开始的位置记录在start中
-			start = offset
-		}
-		offset += int64(len(line) + 1)
-		line = strings.TrimSpace(line)
-		if len(line) == 0 { //空行标志着一条记录的结束
-			if len(recLines) == 0 {
-				continue //遇到连续的空行
-			}
-			err := fn(recLines, start)
+// 从r中读取加密的医闹记录，fname是r所对应的文件名，只用于错误信息
+func extractEncRecords(r io.Reader, fname string, errLog io.Writer, fn func(hdr *FileHeader, rec *Record, off int64) error) (*FileHeader, error) {
+	hdr := defaultHeader()
+	first := true
+	err := extractRecords(r, func(recLines []string, off int64) error {
+		if first && isHeader(recLines) {
+			first = false
+			var err error
+			hdr, err = parseHeader(recLines)
 			if err != nil {
-				return err
+				return fmt.Errorf("读取文件%s时，遇到错误：%s", fname, err.Error())
 			}
-			recLines = recLines[:0] // 清空其内容
-		} else { //没有遇到空行，则一条记录继续新增行
-			recLines = append(recLines, line)
+			return nil
 		}
-	}
-	if len(recLines) != 0 {
-		err := fn(recLines, start)
-		if err != nil {
-			return err
+		first = false
+		if hdr.Version < 3 && len(recLines) != 5 {
+			s := fmt.Sprintf("记录的长度错误，版本%d的文件中每条记录必须正好有5行：%s\n", hdr.Version, strings.Join(recLines, "\n"))
+			errLog.Write([]byte(s))
+			return nil
 		}
-	}
-	return nil
+		rec := parseLines(recLines, errLog)
+		if rec == nil {
+			return nil
+		}
+		return fn(hdr, rec, off)
+	})
+	return hdr, err
 }
 
 // 从文本文件中读取原始医闹记录，并且将它们转换为Record列表
 func ExtractRecordsFromRawFile(fname string) ([]*Record, error) {
+	return ExtractRecordsFromRawFileWithOptions(fname, nil)
+}
+
+// 从文本文件中读取原始医闹记录，并且按照opts将它们转换为Record列表
+func ExtractRecordsFromRawFileWithOptions(fname string, opts *ConvertOptions) ([]*Record, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	enc := EncodingAuto
+	if opts != nil && len(opts.Encoding) != 0 {
+		enc = opts.Encoding
+	}
+	text, _, err := DecodeText(data, enc)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件%s时遇到错误：%s", fname, err.Error())
+	}
 	res := make([]*Record, 0, 100)
-	err := extractRecordsFromFile(fname, func(recLines []string, off int64) error {
-		rec, err := parseRawLines(recLines)
+	err = extractRecords(bytes.NewReader(text), func(recLines []string, off int64) error {
+		rec, err := parseRawLines(recLines, opts)
 		if err != nil {
 			return err
 		}
@@ -235,3 +405,20 @@ func ExtractRecordsFromRawFile(fname string) ([]*Record, error) {
 	})
 	return res, err
 }
+
+// 从加密记录文件中读取医闹记录，返回文件的头部和记录列表，文件中有任何错误时返回错误
+func ExtractRecordsFromEncFile(fname string) (*FileHeader, []*Record, error) {
+	var b bytes.Buffer
+	res := make([]*Record, 0, 100)
+	hdr, err := extractEncRecordsFromFile(fname, &b, func(hdr *FileHeader, rec *Record, off int64) error {
+		res = append(res, rec)
+		return nil
+	})
+	if err == nil && b.Len() != 0 {
+		err = fmt.Errorf("读取文件%s时，遇到错误：%s", fname, b.String())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return hdr, res, nil
+}
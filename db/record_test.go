@@ -11,39 +11,39 @@ import (
 
 var File1 = `
 张若虚，男，2019
-11010920190401911X
+11010920190401961X
 19.0
 春江潮水连海平，海上明月共潮生。
 滟滟随波千万里，何处春江无月明？
 
 张若美，女，2018
-11010920180401911X
+11010920180401984X
 98.0
 江流宛转绕芳甸，月照花林皆似霰。
 空里流霜不觉飞，汀上白沙看不见。`
 
 var File2 = `
 张若虚，男，1999
-11010920190401811X
+11010919990401881X
 97.0
 春江潮水连海平，海上明月共潮生。
 滟滟随波千万里，何处春江无月明？
 
 张若美，女，2018
-11010920180401911X
+11010920180401984X
 94.0
 江流宛转绕芳甸，月照花林皆似霰。
 空里流霜不觉飞，汀上白沙看不见。`
 
 var File3 = `
 张若虚，男，2019
-11010920190401911X
+11010920190401961X
 99.0
 春江潮水连海平，海上明月共潮生。
 滟滟随波千万里，何处春江无月明？
 
-张若，男，2010
-11010920190401911X
+张若，男，2019
+11010920190401961X
 97.0
 举头望明月，低头思故乡。
 露从今夜白，月是故乡明。
@@ -62,18 +62,18 @@ NA
 滟滟随波千万里，何处春江无月明？
 
 张若美，女，2018
-11010920180401911X
+11010920180401984X
 98.0
 空里流霜不觉飞，汀上白沙看不见。`
 
 func TestConvert(t *testing.T) {
 	txt := `
 张若虚，男，2019
-11010920190401911X
+11010920190401961X
 99.0
 
 张若美，女，2018
-11010920180401911X
+11010920180401984X
 98.0
 江流宛转绕芳甸，月照花林皆似霰。
 空里流霜不觉飞，汀上白沙看不见。`
@@ -109,17 +109,22 @@ func TestConvert(t *testing.T) {
 	err = os.Remove("./dat.byn.txt")
 	assert.Equal(t, nil, err)
 
-	res := `77tvf7/2R95SVd7b0p6V05SVgvPZc+aspC7oj5Q5WOY=
-qRrk3oLyVGxF1zpO6bW4n0E4INNTxTy+8p+FRj0H2jE=
+	res := `#YinaoBlacklist
+version: 6
+hash: sha256
+normalize: 1
+
+77tvf7/2R95SVd7b0p6V05SVgvPZc+aspC7oj5Q5WOY=
+IMUg+gy1wkG9UnqY2UaiA0Xwq1Q/NkxqQJR88cYuSJM=
 19.000000
 春江潮水连海平，海上明月共潮生。\n滟滟随波千万里，何处春江无月明？
-770a6955
+5dec0224
 
 NodIhJ4+FFFrYJmBrfMwB/VaxZwfsGcCaeHzyL/cZjk=
-uKZuKBb825p2vFxrb4iapZj5v8K4GCVmd6VWY8y5bw4=
+Ca1GSHMSPmRYhIp/lMqyVDzGu95bwXfVnOXKr2m4am0=
 98.000000
 江流宛转绕芳甸，月照花林皆似霰。\n空里流霜不觉飞，汀上白沙看不见。
-ea839b7a
+c4a068d3
 
 `
 	assert.Equal(t, res, string(dat))
@@ -129,6 +134,8 @@ func TestCheckBaseInfo(t *testing.T) {
 	err := CheckBaseInfo("李四，女，1990")
 	assert.Equal(t, nil, err)
 	err = CheckBaseInfo("张三,男，1943")
+	assert.Equal(t, nil, err)
+	err = CheckBaseInfo("张三，男1943")
 	assert.NotEqual(t, nil, err)
 	err = CheckBaseInfo("张三，nan，1943")
 	assert.NotEqual(t, nil, err)
@@ -149,4 +156,30 @@ func TestCheckID(t *testing.T) {
 	assert.NotEqual(t, nil, err)
 	err = CheckID("NA")
 	assert.Equal(t, nil, err)
+	err = CheckID("11010920190401961X")
+	assert.Equal(t, nil, err)
+	err = CheckID("110109201904019118")
+	assert.Equal(t, nil, err)
+	err = CheckID("99010920190401961X")
+	assert.Contains(t, err.Error(), "地区码")
+	for _, id := range []string{"11000020190401961X", "11000920190401961X", "11800920190401961X", "11010020190401961X", "81010920190401961X"} {
+		err = CheckID(id)
+		assert.Contains(t, err.Error(), "地区码", id)
+	}
+	for _, id := range []string{"429004201904019613", "810000201904019612", "440305201904019611"} { //省直辖县级市、香港居民居住证、普通的市辖区
+		assert.Equal(t, nil, CheckID(id), id)
+	}
+	err = CheckID("11010920190231961X")
+	assert.Contains(t, err.Error(), "不是一个合法的日期")
+	err = CheckID("11010918890401961X")
+	assert.Contains(t, err.Error(), "合理的范围")
+	err = CheckID("110109190504011239") //1905年出生，无法生成合法的基本信息
+	assert.Contains(t, err.Error(), "合理的范围")
+	err = CheckID("110109191201011236")
+	assert.Equal(t, nil, err)
+	info, err := BaseInfoFromID("张三", "110109191201011236")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, CheckBaseInfo(info))
+	err = CheckID("11010920190401961X"[:16] + "18")
+	assert.Contains(t, err.Error(), "应当是")
 }
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"crypto/sha256"
+)
+
+const (
+	fingerprintDomain    = "YinaoBlacklist record fingerprint\x00"
+	DefaultRetractReason = "此记录已被发布者撤回"
+)
+
+// 记录的指纹，用来在撤回记录中指明被撤回的是哪一条记录。置信参数在合并时会被调整，所以不计入指纹
+func (rec *Record) Fingerprint() [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(fingerprintDomain))
+	h.Write(rec.BaseInfoHash[:])
+	h.Write(rec.IDHash[:])
+	h.Write([]byte(rec.Description))
+	var fp [sha256.Size]byte
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// 创建一条撤回target的记录，reason是撤回的原因，为空时使用默认的原因。
+// 撤回记录必须再用签名target的私钥签名才会生效，所以没有签名的记录无法被撤回
+func NewTombstone(target *Record, reason string) *Record {
+	if len(reason) == 0 {
+		reason = DefaultRetractReason
+	}
+	rec := &Record{
+		BaseInfoHash: target.BaseInfoHash,
+		IDHash:       target.IDHash,
+		Description:  reason,
+		Retract:      target.Fingerprint(),
+	}
+	rec.Crc32 = rec.checksum()
+	return rec
+}
+
+// 撤回记录的集合，从被撤回记录的指纹定位到撤回记录
+type tombstones map[[sha256.Size]byte][]*Record
+
+// 增加一条撤回记录，同一个人对同一条记录的撤回只保留一条，返回值表示是否增加了。
+// 指纹只用到了文件中公开的内容，任何人都能伪造没有签名的撤回记录，所以它们不会被加入
+func (ts tombstones) add(tomb *Record) bool {
+	if !tomb.IsSigned() {
+		return false
+	}
+	for _, old := range ts[tomb.Retract] {
+		if old.Signer == tomb.Signer {
+			return false
+		}
+	}
+	ts[tomb.Retract] = append(ts[tomb.Retract], tomb)
+	return true
+}
+
+// 记录是否已被集合中的某条撤回记录撤回
+func (ts tombstones) retracts(rec *Record) bool {
+	if len(ts) == 0 || rec.IsTombstone() {
+		return false
+	}
+	for _, tomb := range ts[rec.Fingerprint()] {
+		if tomb.Retracts(rec) {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否是一条撤回记录
+func (rec *Record) IsTombstone() bool {
+	return rec.Retract != [sha256.Size]byte{}
+}
+
+// 撤回记录rec是否撤回了other，只有发布other的人用同一个私钥签名才能撤回它
+func (rec *Record) Retracts(other *Record) bool {
+	return rec.IsTombstone() && !other.IsTombstone() && rec.IsSigned() &&
+		rec.Signer == other.Signer && rec.Retract == other.Fingerprint()
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetractInRecords(t *testing.T) {
+	owner, _ := GenerateSigningKey()
+	other, _ := GenerateSigningKey()
+	rec := NewRecord("张三，男，2000", "11010920180401984X", 80, "abc")
+	rec.Sign(owner)
+	unsigned := NewRecord("李四，女，1990", "NA", 80, "def")
+
+	forged := NewTombstone(rec, "")
+	forged.Sign(other)
+	assert.True(t, forged.IsTombstone())
+	assert.False(t, forged.Retracts(rec))
+	tomb := NewTombstone(rec, "写错了")
+	tomb.Sign(owner)
+	assert.True(t, tomb.VerifySignature())
+	assert.True(t, tomb.Retracts(rec))
+	assert.False(t, tomb.Retracts(unsigned))
+	assert.False(t, tomb.Retracts(tomb))
+
+	// 撤回记录在被撤回的记录之后加入
+	records := NewRecords()
+	records.Add(*rec, 0)
+	records.Add(*unsigned, 0)
+	records.Add(*forged, 0)
+	assert.Equal(t, 3, records.Len())
+	records.Add(*tomb, 0)
+	assert.Equal(t, 3, records.Len())
+	assert.Equal(t, 1, records.Retracted())
+
+	// 撤回记录在被撤回的记录之前加入，并且撤回记录本身会被保留下来
+	var b bytes.Buffer
+	err := records.WriteToFile(&b)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile("./retract.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+	records = NewRecords()
+	records.Add(*tomb, 0)
+	records.Add(*rec, 0)
+	assert.Equal(t, 1, records.Len())
+	assert.Equal(t, 1, records.Retracted())
+
+	// 查询时不会返回已被撤回的记录，也不会返回撤回记录
+	db, err := NewDBFromFiles([]string{"./retract.yinao.txt"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, db.Len())
+	res, err := db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(res))
+	res, err = db.SearchBaseInfo("李四，女，1990")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+	db.Close()
+
+	os.RemoveAll("./retract.yinao.txt")
+}
+
+func TestUnsignedTombstone(t *testing.T) {
+	// 任何人都能为没有签名的记录生成指纹，所以没有签名的撤回记录不会撤回任何记录，合并时也会被丢弃
+	unsigned := NewRecord("李四，女，1990", "NA", 80, "def")
+	tomb := NewTombstone(unsigned, "")
+	assert.False(t, tomb.Retracts(unsigned))
+	records := NewRecords()
+	records.Add(*unsigned, 0)
+	records.Add(*tomb, 0)
+	assert.Equal(t, 1, records.Len())
+	assert.Equal(t, 0, records.Retracted())
+	records = NewRecords()
+	records.Add(*tomb, 0)
+	records.Add(*unsigned, 0)
+	assert.Equal(t, 1, records.Len())
+	assert.Equal(t, 0, records.Retracted())
+	assert.Equal(t, 1, records.UnsignedTombstones())
+
+	// 文件中没有签名的撤回记录在载入时也不会生效
+	var b bytes.Buffer
+	err := WriteRecordsToFile([]*Record{unsigned, tomb}, &b)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile("./unsigned.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll("./unsigned.yinao.txt")
+	db, err := NewDBFromFiles([]string{"./unsigned.yinao.txt"})
+	assert.Equal(t, nil, err)
+	defer db.Close()
+	res, err := db.SearchBaseInfo("李四，女，1990")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+
+	// 合并时被忽略的撤回记录会被写入errLog，以免发布者以为已经撤回
+	var errLog bytes.Buffer
+	records = NewRecords()
+	err = records.AddEncRecordsInFile("./unsigned.yinao.txt", 0, &errLog)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, records.Len())
+	assert.Equal(t, 1, records.UnsignedTombstones())
+	assert.Contains(t, errLog.String(), "没有签名")
+}
+
+func TestParseTombstone(t *testing.T) {
+	priv, _ := GenerateSigningKey()
+	rec := NewRecord("张三，男，2000", "NA", 80, "abc")
+	tomb := NewTombstone(rec, "")
+	tomb.Sign(priv)
+	lines := tomb.ToLines()
+	assert.Equal(t, 7, len(lines))
+	assert.Equal(t, DefaultRetractReason, lines[3])
+
+	var errLog bytes.Buffer
+	parsed := parseLines(lines, &errLog)
+	assert.Equal(t, "", errLog.String())
+	assert.Equal(t, tomb, parsed)
+
+	// 撤回的目标也被签名了，不能被篡改
+	other := NewTombstone(NewRecord("张三，男，2000", "NA", 80, "xyz"), "")
+	lines[5] = other.ToLines()[5]
+	assert.Nil(t, parseLines(lines, &errLog))
+	assert.Contains(t, errLog.String(), "签名错误")
+
+	errLog.Reset()
+	lines[5] = "retract: abc"
+	assert.Nil(t, parseLines(lines, &errLog))
+	assert.Contains(t, errLog.String(), "撤回记录的格式错误")
+}
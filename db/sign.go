@@ -0,0 +1,91 @@
+package db
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const sigDomain = "YinaoBlacklist record signature\x00"
+
+// 随机生成一个贡献者的签名私钥
+func GenerateSigningKey() (ed25519.PrivateKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	return priv, err
+}
+
+// 私钥的文本表示（私钥种子的base64编码），用于保存在私钥文件中
+func FormatPrivateKey(priv ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(priv.Seed())
+}
+
+// 解析私钥的文本表示
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("私钥的格式错误")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// 公钥的文本表示（base64编码），它被用来标识贡献者
+func FormatPublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// 解析公钥的文本表示
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	bz, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(bz) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("公钥的格式错误：%s", s)
+	}
+	return ed25519.PublicKey(bz), nil
+}
+
+// 记录中被签名的内容。置信参数在合并时会被调整，所以不被签名；记录中的日期以及撤回记录中被撤回记录的指纹也被签名
+func (rec *Record) signedMessage() []byte {
+	msg := make([]byte, 0, len(sigDomain)+3*len(rec.BaseInfoHash)+len(rec.Description))
+	msg = append(msg, sigDomain...)
+	msg = append(msg, rec.BaseInfoHash[:]...)
+	msg = append(msg, rec.IDHash[:]...)
+	msg = append(msg, rec.Description...)
+	if !rec.IncidentDate.IsZero() {
+		msg = append(msg, "\x00date: "+rec.IncidentDate.Format(DateLayout)...)
+	}
+	if !rec.PublishDate.IsZero() {
+		msg = append(msg, "\x00published: "+rec.PublishDate.Format(DateLayout)...)
+	}
+	if rec.IsTombstone() {
+		msg = append(msg, rec.Retract[:]...)
+	}
+	return msg
+}
+
+// 记录是否带有签名
+func (rec *Record) IsSigned() bool {
+	return rec.Signer != [ed25519.PublicKeySize]byte{}
+}
+
+// 用贡献者的私钥对记录签名，签名之后就不能再修改描述了
+func (rec *Record) Sign(priv ed25519.PrivateKey) {
+	copy(rec.Signer[:], priv.Public().(ed25519.PublicKey))
+	copy(rec.Signature[:], ed25519.Sign(priv, rec.signedMessage()))
+}
+
+// 检查记录的签名是否正确，没有签名的记录返回false
+func (rec *Record) VerifySignature() bool {
+	if !rec.IsSigned() {
+		return false
+	}
+	return ed25519.Verify(rec.Signer[:], rec.signedMessage(), rec.Signature[:])
+}
+
+// 签名者的公钥的文本表示，没有签名时为空字符串
+func (rec *Record) SignerID() string {
+	if !rec.IsSigned() {
+		return ""
+	}
+	return FormatPublicKey(rec.Signer[:])
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigningKey(t *testing.T) {
+	priv, err := GenerateSigningKey()
+	assert.Equal(t, nil, err)
+	priv2, err := ParsePrivateKey(FormatPrivateKey(priv) + "\n")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, priv, priv2)
+	_, err = ParsePrivateKey("abc")
+	assert.NotEqual(t, nil, err)
+
+	pub, err := ParsePublicKey(FormatPublicKey(priv.Public().(ed25519.PublicKey)))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, priv.Public(), pub)
+	_, err = ParsePublicKey(FormatPrivateKey(priv) + "AAAA")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSignRecord(t *testing.T) {
+	priv, _ := GenerateSigningKey()
+	rec := NewRecord("张若美，女，2018", "11010920180401984X", 98.0, "江流宛转绕芳甸，月照花林皆似霰。")
+	assert.False(t, rec.IsSigned())
+	assert.False(t, rec.VerifySignature())
+	assert.Equal(t, "", rec.SignerID())
+	rec.Sign(priv)
+	assert.True(t, rec.VerifySignature())
+	assert.Equal(t, FormatPublicKey(priv.Public().(ed25519.PublicKey)), rec.SignerID())
+
+	lines := rec.ToLines()
+	assert.Equal(t, 6, len(lines))
+	assert.True(t, strings.HasPrefix(lines[5], "sig: "+rec.SignerID()+" "))
+	var errLog bytes.Buffer
+	parsed := parseLines(lines, &errLog)
+	assert.Equal(t, "", errLog.String())
+	assert.Equal(t, rec, parsed)
+
+	// 置信参数不在签名的范围之内
+	lines[2] = "50.000000"
+	parsed = parseLines(lines, &errLog)
+	assert.Equal(t, "", errLog.String())
+	assert.True(t, parsed.VerifySignature())
+
+	// 篡改描述之后，即使重新计算了校验码，签名也会出错
+	forged := *rec
+	forged.Description = "举头望明月，低头思故乡。"
+	forged.Crc32 = forged.checksum()
+	assert.Nil(t, parseLines(forged.ToLines(), &errLog))
+	assert.True(t, strings.HasPrefix(errLog.String(), "签名错误"))
+
+	errLog.Reset()
+	lines = rec.ToLines()
+	lines[5] = "sig: abc"
+	assert.Nil(t, parseLines(lines, &errLog))
+	assert.True(t, strings.HasPrefix(errLog.String(), "签名的格式错误"))
+	errLog.Reset()
+	lines[5] = "color: red"
+	assert.Nil(t, parseLines(lines, &errLog))
+	assert.True(t, strings.HasPrefix(errLog.String(), "未知的扩展字段"))
+
+	// 签名者不同的记录不是同一条记录
+	other := *rec
+	priv2, _ := GenerateSigningKey()
+	other.Sign(priv2)
+	assert.False(t, rec.IsSame(other))
+}
+
+func TestSignedRecordsInFile(t *testing.T) {
+	priv, _ := GenerateSigningKey()
+	err := ioutil.WriteFile("./in.txt", []byte(File1), 0644)
+	assert.Equal(t, nil, err)
+	opts := &ConvertOptions{SigningKey: priv}
+	recList, err := ExtractRecordsFromRawFileWithOptions("./in.txt", opts)
+	assert.Equal(t, nil, err)
+	os.MkdirAll("./a", os.ModePerm)
+	var b bytes.Buffer
+	err = WriteRecordsToFileWithHeader(opts.Header(), recList, &b)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile("./a/A.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+
+	var errLog bytes.Buffer
+	records := NewRecords()
+	records.AddEncRecordsInDir("./a", 1, &errLog)
+	assert.Equal(t, "", errLog.String())
+	b.Reset()
+	err = records.WriteToFile(&b)
+	assert.Equal(t, nil, err)
+	err = ioutil.WriteFile("./out.yinao.txt", b.Bytes(), 0644)
+	assert.Equal(t, nil, err)
+
+	db, err := NewDBFromFiles([]string{"./out.yinao.txt"})
+	assert.Equal(t, nil, err)
+	res, err := db.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, float32(99.0), res[0].Confidence)
+	assert.Equal(t, FormatPublicKey(priv.Public().(ed25519.PublicKey)), res[0].SignerID())
+	lines := res[0].ToLines()
+	assert.Equal(t, "======= 签名者："+res[0].SignerID(), lines[len(lines)-1])
+	db.Close()
+
+	// 版本2的文件中不能有扩展行
+	txt := strings.Replace(b.String(), fmt.Sprintf("version: %d", FormatVersion), "version: 2", 1)
+	txt = strings.Replace(txt, "normalize: 1\n", "", 1)
+	err = ioutil.WriteFile("./out.yinao.txt", []byte(txt), 0644)
+	assert.Equal(t, nil, err)
+	_, err = NewDBFromFiles([]string{"./out.yinao.txt"})
+	assert.Contains(t, err.Error(), "版本2的文件中每条记录必须正好有5行")
+
+	os.RemoveAll("./in.txt")
+	os.RemoveAll("./a")
+	os.RemoveAll("./out.yinao.txt")
+}
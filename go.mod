@@ -6,4 +6,6 @@ require (
 	github.com/andlabs/ui v0.0.0-20180902183112-867a9e5a498d
 	github.com/gogo/protobuf v1.3.1 // indirect
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/text v0.3.3
 )
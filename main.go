@@ -1,14 +1,16 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"bytes"
+	"crypto/ed25519"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andlabs/ui"
 	_ "github.com/andlabs/ui/winmanifest"
@@ -18,6 +20,8 @@ import (
 
 const (
 	Count = 10
+
+	argon2Label = "使用argon2id哈希方案（计算较慢，但更难被暴力破解）"
 )
 
 var mainwin *ui.Window
@@ -70,9 +74,20 @@ func makeConvertPage() ui.Control {
 	hbox.Append(selBtn, false)
 	hbox.Append(entry, true)
 
+	secretBox, secretEntry := makeSecretRow()
+	vbox.Append(secretBox, false)
+	argon2Box := ui.NewCheckbox(argon2Label)
+	vbox.Append(argon2Box, false)
+	encryptBox := ui.NewCheckbox("加密对医闹行为的描述（只有知道患者基本信息或身份证号的人才能看到）")
+	vbox.Append(encryptBox, false)
+	fillBox := ui.NewCheckbox("基本信息中只写了姓名，或者留空了性别、出生年份时，用身份证号补全它们")
+	vbox.Append(fillBox, false)
+	keyBox, keyEntry := makeFileRow("选择签名私钥文件（可选）")
+	vbox.Append(keyBox, false)
+
 	runBtn := ui.NewButton("转换为加密记录文件")
 	runBtn.OnClicked(func(*ui.Button) {
-		runConvert(entry.Text())
+		runConvert(entry.Text(), secretEntry.Text(), keyEntry.Text(), argon2Box.Checked(), encryptBox.Checked(), fillBox.Checked())
 	})
 	vbox.Append(runBtn, false)
 	return vbox
@@ -95,6 +110,12 @@ func makeMergePage() ui.Control {
 		grid.Append(deltaEntryList[i], 4, i, 1, 1, false, ui.AlignFill, false, ui.AlignFill)
 	}
 	vbox.Append(grid, true)
+	secretBox, secretEntry := makeSecretRow()
+	vbox.Append(secretBox, false)
+	argon2Box := ui.NewCheckbox(argon2Label)
+	vbox.Append(argon2Box, false)
+	keyringBox, keyringEntry := makeFileRow("选择密钥环文件（可选）")
+	vbox.Append(keyringBox, false)
 	runBtn := ui.NewButton("合并为单一记录文件")
 	runBtn.OnClicked(func(*ui.Button) {
 		dirList := make([]string, Count)
@@ -105,7 +126,7 @@ func makeMergePage() ui.Control {
 		for i, e := range deltaEntryList {
 			deltaList[i] = e.Text()
 		}
-		runMerge(dirList, deltaList)
+		runMerge(dirList, deltaList, secretEntry.Text(), keyringEntry.Text(), argon2Box.Checked())
 	})
 	vbox.Append(runBtn, false)
 	return vbox
@@ -129,6 +150,8 @@ func makeLoadPage() ui.Control {
 		grid.Append(entry, 1, i, 1, 1, true, ui.AlignFill, false, ui.AlignFill)
 	}
 	vbox.Append(grid, true)
+	secretBox, secretEntry := makeSecretRow()
+	vbox.Append(secretBox, false)
 	runBtn := ui.NewButton("载入上述所有记录文件到内存中")
 	runBtn.OnClicked(func(*ui.Button) {
 		fileList := make([]string, 0, Count)
@@ -138,24 +161,49 @@ func makeLoadPage() ui.Control {
 			}
 		}
 		fmt.Printf("iiiiii %v\n", fileList)
-		runLoad(fileList)
+		runLoad(fileList, secretEntry.Text())
 	})
 	vbox.Append(runBtn, false)
 	return vbox
 }
 
+// 选择群组密钥文件的控件，不使用带密钥的哈希方案时留空即可
+func makeSecretRow() (*ui.Box, *ui.Entry) {
+	return makeFileRow("选择群组密钥文件（可选）")
+}
+
+// 选择一个文件的控件，label是按钮上的文字
+func makeFileRow(label string) (*ui.Box, *ui.Entry) {
+	hbox := ui.NewHorizontalBox()
+	hbox.SetPadded(true)
+	selBtn := ui.NewButton(label)
+	entry := ui.NewEntry()
+	entry.SetReadOnly(true)
+	selBtn.OnClicked(func(*ui.Button) {
+		filename := ui.OpenFile(mainwin)
+		entry.SetText(filename)
+	})
+	hbox.Append(selBtn, false)
+	hbox.Append(entry, true)
+	return hbox, entry
+}
+
 func makeQueryPage() ui.Control {
 	vbox := ui.NewVerticalBox()
 	resultEntry := ui.NewMultilineEntry()
 	resultEntry.SetReadOnly(true)
 
-	vbox.Append(ui.NewLabel("输入基本信息（格式为“姓名，性别，出生年份”，注意中间要用中文逗号隔开）："), false)
+	vbox.Append(ui.NewLabel("输入基本信息（格式为“姓名，性别，出生年份”，注意中间要用中文逗号隔开；如果同时输入了身份证号，也可以只输入姓名）："), false)
 	hbox := ui.NewHorizontalBox()
 	baseInfoEntry := ui.NewEntry()
 	hbox.Append(baseInfoEntry, true)
 	baseInfoBtn := ui.NewButton("按基本信息进行查询")
 	var idEntry *ui.Entry
 	baseInfoBtn.OnClicked(func(*ui.Button) {
+		if isNameOnly(baseInfoEntry.Text()) && len(idEntry.Text()) != 0 {
+			runQueryWithIDAndName(resultEntry, idEntry.Text(), baseInfoEntry.Text())
+			return
+		}
 		idEntry.SetText("")
 		runQueryWithBaseInfo(resultEntry, baseInfoEntry.Text())
 	})
@@ -169,6 +217,10 @@ func makeQueryPage() ui.Control {
 	hbox.Append(idEntry, true)
 	idBtn := ui.NewButton("按身份证号进行查询")
 	idBtn.OnClicked(func(*ui.Button) {
+		if isNameOnly(baseInfoEntry.Text()) {
+			runQueryWithIDAndName(resultEntry, idEntry.Text(), baseInfoEntry.Text())
+			return
+		}
 		baseInfoEntry.SetText("")
 		runQueryWithID(resultEntry, idEntry.Text())
 	})
@@ -176,6 +228,17 @@ func makeQueryPage() ui.Control {
 	hbox.SetPadded(true)
 	vbox.Append(hbox, false)
 
+	vbox.Append(ui.NewLabel("批量查询（名单文件每行一个患者，可以带有“姓名”、“性别”、“出生年份”、“身份证号”等表头）："), false)
+	hbox, listEntry := makeFileRow("选择名单文件（CSV或TSV格式）")
+	batchBtn := ui.NewButton("批量查询")
+	batchBtn.OnClicked(func(*ui.Button) {
+		baseInfoEntry.SetText("")
+		idEntry.SetText("")
+		runBatchQuery(resultEntry, listEntry.Text())
+	})
+	hbox.Append(batchBtn, false)
+	vbox.Append(hbox, false)
+
 	vbox.Append(resultEntry, true)
 
 	return vbox
@@ -200,29 +263,102 @@ func checkExist(path string, isDir bool) bool {
 	return true
 }
 
+// 读取群组密钥文件，没有选择密钥文件时返回nil
+func readSecret(fname string) ([]byte, bool) {
+	if len(fname) == 0 {
+		return nil, true
+	}
+	if !checkExist(fname, false) {
+		return nil, false
+	}
+	dat, err := ioutil.ReadFile(fname)
+	if err != nil {
+		ui.MsgBoxError(mainwin, "错误！", err.Error())
+		return nil, false
+	}
+	dat = bytes.TrimSpace(dat)
+	if len(dat) == 0 {
+		ui.MsgBoxError(mainwin, "错误！", "密钥文件 "+fname+" 是空的！")
+		return nil, false
+	}
+	return dat, true
+}
+
+// 选择哈希方法：useArgon2为true时使用默认参数的argon2id，有群组密钥时使用带密钥的哈希方案，否则使用sha256
+func chooseHasher(secret []byte, useArgon2 bool) (db.Hasher, bool) {
+	if useArgon2 {
+		if secret != nil {
+			ui.MsgBoxError(mainwin, "错误！", "argon2id哈希方案不使用群组密钥")
+			return nil, false
+		}
+		h, _ := db.NewArgon2Hasher(db.DefaultArgon2Time, db.DefaultArgon2Memory, db.DefaultArgon2Threads)
+		return h, true
+	}
+	if secret == nil {
+		return db.SHA256Hasher, true
+	}
+	return db.NewHMACHasher(secret), true
+}
+
 // 将原始记录文件转为加密记录文件
-func runConvert(fname string) {
+func runConvert(fname, secretFile, keyFile string, useArgon2, encryptDesc, fillFromID bool) {
 	if !checkExist(fname, false) {
 		ui.MsgBoxError(mainwin, "错误！", "文件 "+fname+" 不存在！")
 		return
 	}
-	if !strings.HasSuffix(fname, ".txt") {
-		ui.MsgBoxError(mainwin, "非文本文件", "您选择的文件不是文本文件，无法进行处理。")
+	ext := strings.ToLower(filepath.Ext(fname))
+	if ext != ".txt" && ext != ".csv" && ext != ".tsv" {
+		ui.MsgBoxError(mainwin, "非文本文件", "您选择的文件不是文本文件或者表格文件，无法进行处理。")
 		return
 	}
-	recList, err := db.ExtractRecordsFromRawFile(fname)
+	secret, ok := readSecret(secretFile)
+	if !ok {
+		return
+	}
+	hasher, ok := chooseHasher(secret, useArgon2)
+	if !ok {
+		return
+	}
+	var signingKey ed25519.PrivateKey
+	if len(keyFile) != 0 {
+		if !checkExist(keyFile, false) {
+			return
+		}
+		dat, err := ioutil.ReadFile(keyFile)
+		if err == nil {
+			signingKey, err = db.ParsePrivateKey(string(dat))
+		}
+		if err != nil {
+			ui.MsgBoxError(mainwin, "错误！", "无法读取签名私钥："+err.Error())
+			return
+		}
+	}
+	opts := &db.ConvertOptions{
+		Hasher:             hasher,
+		EncryptDescription: encryptDesc,
+		SigningKey:         signingKey,
+		PublishDate:        time.Now(),
+		FillFromID:         fillFromID,
+	}
+	var recList []*db.Record
+	var err error
+	if ext == ".txt" {
+		recList, err = db.ExtractRecordsFromRawFileWithOptions(fname, opts)
+	} else { //表格文件按表头识别各列
+		recList, err = db.ExtractRecordsFromCSVFile(fname, nil, opts)
+	}
 	if err != nil {
 		ui.MsgBoxError(mainwin, "错误！", err.Error())
 		return
 	}
-	outFile := fname[:len(fname)-4] + db.EncFileSuffix
+	outFile := fname[:len(fname)-len(ext)] + db.EncFileSuffix
 	out, err := os.OpenFile(outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
 		ui.MsgBoxError(mainwin, "错误！", err.Error())
 		return
 	}
 	defer out.Close()
-	err = db.WriteRecordsToFile(recList, out)
+	err = db.WriteRecordsToFileWithHeader(opts.Header(), recList, out)
 	if err != nil {
 		ui.MsgBoxError(mainwin, "错误！", err.Error())
 		return
@@ -231,7 +367,7 @@ func runConvert(fname string) {
 }
 
 // 扫描并且合并加密记录文件
-func runMerge(dirList, deltaStrList []string) {
+func runMerge(dirList, deltaStrList []string, secretFile, keyringFile string, useArgon2 bool) {
 	for _, dir := range dirList {
 		if len(dir) != 0 && !checkExist(dir, true) {
 			ui.MsgBoxError(mainwin, "错误！", "目录 "+dir+" 不存在！")
@@ -247,6 +383,14 @@ func runMerge(dirList, deltaStrList []string) {
 		}
 		deltaList[i] = float32(delta / 100.0)
 	}
+	secret, ok := readSecret(secretFile)
+	if !ok {
+		return
+	}
+	hasher, ok := chooseHasher(secret, useArgon2)
+	if !ok {
+		return
+	}
 
 	ex, _ := os.Executable()
 	logName := path.Join(filepath.Dir(ex), "log.txt")
@@ -256,7 +400,14 @@ func runMerge(dirList, deltaStrList []string) {
 		return
 	}
 
-	records := db.NewRecords()
+	records := db.NewRecordsWithScheme(hasher.Scheme())
+	if len(keyringFile) != 0 {
+		if records.Keyring, err = db.LoadKeyring(keyringFile); err != nil {
+			logfile.Close()
+			ui.MsgBoxError(mainwin, "错误！", err.Error())
+			return
+		}
+	}
 	for i, dir := range dirList {
 		if len(dir) == 0 {
 			continue
@@ -281,7 +432,8 @@ func runMerge(dirList, deltaStrList []string) {
 		ui.MsgBoxError(mainwin, "未选择文件", "您并未选择一个输出文件，转换后的结果不会被保存。")
 		return
 	}
-	if !strings.HasSuffix(outFile, db.EncFileSuffix) {
+	binary := strings.HasSuffix(outFile, db.BinFileSuffix) //以.yinao.bin结尾时保存为二进制格式，便于转发
+	if !binary && !strings.HasSuffix(outFile, db.EncFileSuffix) {
 		outFile = outFile + db.EncFileSuffix
 	}
 	out, err := os.OpenFile(outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
@@ -290,95 +442,222 @@ func runMerge(dirList, deltaStrList []string) {
 		return
 	}
 	defer out.Close()
-	err = records.WriteToFile(out)
+	if binary {
+		err = records.WriteToBinary(out)
+	} else {
+		err = records.WriteToFile(out)
+	}
 	if err != nil {
 		ui.MsgBoxError(mainwin, "错误！", err.Error())
 		return
 	}
 }
 
-var YiNaoDB *db.DB //内存中保存的医闹记录
+var YiNaoDB *db.DB                 //内存中保存的医闹记录
+var YiNaoFilters []*db.BloomFilter //内存中保存的布隆过滤器，只能用来初步筛查
 
-// 将记录载入内存(供查询用)
-func runLoad(fileList []string) {
+// 将记录载入内存(供查询用)，以.yinao.bloom结尾的文件作为布隆过滤器载入
+func runLoad(fileList []string, secretFile string) {
 	for _, file := range fileList {
 		if !checkExist(file, false) {
 			return
 		}
 	}
+	secret, ok := readSecret(secretFile)
+	if !ok {
+		return
+	}
+	var encList []string
+	var filters []*db.BloomFilter
+	for _, file := range fileList {
+		if !strings.HasSuffix(file, db.BloomFileSuffix) {
+			encList = append(encList, file)
+			continue
+		}
+		filter, err := db.LoadBloomFilter(file, secret)
+		if err != nil {
+			ui.MsgBoxError(mainwin, "错误！", err.Error())
+			return
+		}
+		filters = append(filters, filter)
+	}
 	if YiNaoDB != nil {
 		YiNaoDB.Close()
+		YiNaoDB = nil
 	}
-	var err error
-	YiNaoDB, err = db.NewDBFromFiles(fileList)
-	if err != nil {
-		ui.MsgBoxError(mainwin, "错误！", err.Error())
-		return
+	YiNaoFilters = filters
+	if len(encList) != 0 {
+		var err error
+		YiNaoDB, err = db.NewDBFromFilesWithOptions(encList, &db.LoadOptions{Secret: secret})
+		if err != nil {
+			ui.MsgBoxError(mainwin, "错误！", err.Error())
+			return
+		}
+		YiNaoDB.Watch(5*time.Second, nil) //记录文件被替换时，在后台重新载入，查询不需要中断
 	}
 	ui.MsgBox(mainwin, "成功", "记录已成功载入内存")
 }
 
+// 是否已经载入了记录或者布隆过滤器
+func checkLoaded() bool {
+	if YiNaoDB == nil && len(YiNaoFilters) == 0 {
+		ui.MsgBoxError(mainwin, "错误！", "尚未载入任何数据")
+		return false
+	}
+	return true
+}
+
 // 按基本信息进行查询(使用内存中载入的记录)
 func runQueryWithBaseInfo(resultEntry *ui.MultilineEntry, baseInfo string) {
-	if YiNaoDB == nil {
-		ui.MsgBoxError(mainwin, "错误！", "尚未载入任何数据")
+	if !checkLoaded() {
 		return
 	}
-	if err := db.CheckBaseInfo(baseInfo); err != nil {
-		ui.MsgBoxError(mainwin, "错误！", err.Error())
+	var recList []*db.RecordInFile
+	if YiNaoDB != nil {
+		var err error
+		if recList, err = YiNaoDB.SearchBaseInfo(baseInfo); err != nil {
+			ui.MsgBoxError(mainwin, "错误！", err.Error())
+			return
+		}
+	}
+	writeResultWithFilters(resultEntry, recList, func(f *db.BloomFilter) (bool, error) {
+		return f.MayContainBaseInfo(baseInfo)
+	})
+}
+
+// 按身份证信息进行查询(使用内存中载入的记录)
+func runQueryWithID(resultEntry *ui.MultilineEntry, id string) {
+	if !checkLoaded() {
 		return
 	}
-	h := sha256.Sum256([]byte(baseInfo))
-	recList, err := YiNaoDB.QueryBaseInfo(h)
-	if err != nil {
-		ui.MsgBoxError(mainwin, "错误！", err.Error())
+	var recList []*db.RecordInFile
+	if YiNaoDB != nil {
+		var err error
+		if recList, err = YiNaoDB.SearchID(id); err != nil {
+			ui.MsgBoxError(mainwin, "错误！", err.Error())
+			return
+		}
+	}
+	writeResultWithFilters(resultEntry, recList, func(f *db.BloomFilter) (bool, error) {
+		return f.MayContainID(id)
+	})
+}
+
+// 基本信息输入框中是否只输入了姓名
+func isNameOnly(text string) bool {
+	text = db.NormalizeBaseInfo(text)
+	return len(text) != 0 && !strings.Contains(text, "，")
+}
+
+// 只输入了身份证号和姓名时，按身份证号查询，并且用身份证号中的性别和出生年份生成基本信息进行查询(使用内存中载入的记录)
+func runQueryWithIDAndName(resultEntry *ui.MultilineEntry, id, name string) {
+	if !checkLoaded() {
 		return
 	}
-	info2 := db.BaseInfoToAdjacentYears(baseInfo)
-	var hash2 [2][sha256.Size]byte
-	for i, info := range info2 {
-		hash2[i] = sha256.Sum256([]byte(info))
-		extraList, _ := YiNaoDB.QueryBaseInfo(hash2[i])
-		recList = append(recList, extraList...)
-	}
-	writeResult(resultEntry, recList, func(in string) string {
-		out := strings.ReplaceAll(in, base64.StdEncoding.EncodeToString(h[:]), baseInfo)
-		out = strings.ReplaceAll(out, base64.StdEncoding.EncodeToString(hash2[0][:]), info2[0])
-		return strings.ReplaceAll(out, base64.StdEncoding.EncodeToString(hash2[1][:]), info2[1])
+	var recList []*db.RecordInFile
+	if YiNaoDB != nil {
+		var err error
+		if recList, err = YiNaoDB.SearchIDWithName(id, name); err != nil {
+			ui.MsgBoxError(mainwin, "错误！", err.Error())
+			return
+		}
+	}
+	writeResultWithFilters(resultEntry, recList, func(f *db.BloomFilter) (bool, error) {
+		return f.MayContainIDWithName(id, name)
 	})
 }
 
-// 按身份证信息进行查询(使用内存中载入的记录)
-func runQueryWithID(resultEntry *ui.MultilineEntry, id string) {
+// 对名单文件中的患者逐个进行查询(使用内存中载入的记录)，显示查询到的记录，并且可以把报告保存为CSV文件
+func runBatchQuery(resultEntry *ui.MultilineEntry, listFile string) {
 	if YiNaoDB == nil {
 		ui.MsgBoxError(mainwin, "错误！", "尚未载入任何数据")
 		return
 	}
-	if err := db.CheckID(id); err != nil {
+	if !checkExist(listFile, false) {
+		return
+	}
+	rows, err := db.ReadBatchFile(listFile)
+	if err != nil {
 		ui.MsgBoxError(mainwin, "错误！", err.Error())
 		return
 	}
-	h := sha256.Sum256([]byte(id))
-	recList, err := YiNaoDB.QueryID(h)
+	results, err := YiNaoDB.SearchBatch(rows)
 	if err != nil {
 		ui.MsgBoxError(mainwin, "错误！", err.Error())
 		return
 	}
-	writeResult(resultEntry, recList, func(in string) string {
-		return strings.ReplaceAll(in, base64.StdEncoding.EncodeToString(h[:]), id)
-	})
+	var recList []*db.RecordInFile
+	var invalid []string
+	matched := 0
+	for _, res := range results {
+		if len(res.Matches) != 0 {
+			matched++
+		}
+		recList = append(recList, res.Matches...)
+		for _, e := range res.Errors {
+			invalid = append(invalid, fmt.Sprintf("第%d行：%s", res.Line, e))
+		}
+	}
+	writeResult(resultEntry, recList)
+	if len(invalid) != 0 {
+		resultEntry.Append("以下各行输入有误，没有被查询：\n" + strings.Join(invalid, "\n") + "\n")
+	}
+
+	summary := fmt.Sprintf("共查询%d行，其中%d行查询到记录，%d条输入有误。接下来请您选择一个输出文件用于保存查询报告。", len(results), matched, len(invalid))
+	ui.MsgBox(mainwin, "批量查询完毕", summary)
+	outFile := ui.SaveFile(mainwin)
+	if len(outFile) == 0 {
+		return
+	}
+	out, err := os.OpenFile(outFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		ui.MsgBoxError(mainwin, "错误！", err.Error())
+		return
+	}
+	defer out.Close()
+	if err = db.WriteBatchReport(out, results); err != nil {
+		ui.MsgBoxError(mainwin, "错误！", err.Error())
+	}
+}
+
+// 显示查询结果，并用载入的布隆过滤器进行初步筛查，可能有记录时只注明这一点，不显示任何描述
+func writeResultWithFilters(resultEntry *ui.MultilineEntry, recList []*db.RecordInFile, check func(f *db.BloomFilter) (bool, error)) {
+	maybe := false
+	for _, f := range YiNaoFilters {
+		ok, err := check(f)
+		if err != nil {
+			ui.MsgBoxError(mainwin, "错误！", err.Error())
+			return
+		}
+		maybe = maybe || ok
+	}
+	if maybe && len(recList) == 0 {
+		resultEntry.SetText("")
+	} else {
+		writeResult(resultEntry, recList)
+	}
+	if maybe {
+		resultEntry.Append("======= 布隆过滤器：可能有记录，请向网络中的其他医院查询详细信息\n")
+	}
 }
 
-func writeResult(resultEntry *ui.MultilineEntry, recList []*db.RecordInFile, fn func(string) string) {
+// 显示查询结果，哈希值会被替换为查询时输入的明文
+func writeResult(resultEntry *ui.MultilineEntry, recList []*db.RecordInFile) {
 	if len(recList) == 0 {
 		resultEntry.SetText("没有查询到记录")
 	} else {
 		resultEntry.SetText("")
 	}
 	for _, rec := range recList {
-		for _, line := range rec.ToLines() {
+		lines := rec.ToLines()
+		if len(rec.BaseInfo) != 0 {
+			lines[1] = rec.BaseInfo
+		}
+		if len(rec.ID) != 0 {
+			lines[2] = rec.ID
+		}
+		for _, line := range lines {
 			line = strings.ReplaceAll(line, "\\n", "\n")
-			line = fn(line)
 			resultEntry.Append(line + "\n")
 		}
 		resultEntry.Append("\n")
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+const DefaultPrefixLength = 5 // 客户端默认发送的哈希值前缀的长度（十六进制位数），每个前缀约对应全部哈希值的一百万分之一
+
+// 查询服务的客户端，它进行k-匿名查询：在本地计算哈希值，只把哈希值的前缀发给服务器，
+// 再在本地比较服务器返回的各条记录的完整哈希值，并用查询时的明文解密描述。
+// 每次查询只发送一个前缀：如果同时发送出生年份加一和减一、其他写法或者其他哈希方案的前缀，
+// 服务器就可以用一组互相关联的前缀逐一检验猜测的患者，所以它不像db.DB.SearchBaseInfo那样查询相邻的年份
+type Client struct {
+	URL          string       // 查询服务的地址，例如http://127.0.0.1:8765
+	Secret       []byte       // 群组密钥，用于查询使用带密钥哈希方案的文件，不需要时可以为nil
+	Scheme       string       // 使用的哈希方案，为空时服务器上的文件必须只使用一种哈希方案
+	PrefixLength int          // 前缀的长度，越短越难推测出查询的是谁，但服务器返回的记录越多。为0时使用DefaultPrefixLength
+	HTTPClient   *http.Client // 为nil时使用http.DefaultClient
+}
+
+// 创建查询服务的客户端，secret是群组密钥，不需要时可以为nil
+func NewClient(url string, secret []byte) *Client {
+	return &Client{URL: url, Secret: secret}
+}
+
+// 请求查询服务的一个接口，将返回的JSON解析到v中
+func (c *Client) get(path string, params url.Values, v interface{}) error {
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u := strings.TrimRight(c.URL, "/") + path
+	if len(params) != 0 {
+		u += "?" + params.Encode()
+	}
+	resp, err := hc.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var errRes ErrorResult
+		if json.NewDecoder(resp.Body).Decode(&errRes) == nil && len(errRes.Error) != 0 {
+			return fmt.Errorf("查询服务返回错误：%s", errRes.Error)
+		}
+		return fmt.Errorf("查询服务返回错误：%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// 确定查询时使用的哈希方法：c.Scheme，或者服务器上的文件所使用的唯一的哈希方案。
+// 同时返回服务器上的文件所使用的各个规范化方法的版本
+func (c *Client) hasher() (db.Hasher, []int, error) {
+	var schemes SchemesResult
+	if err := c.get("/range/schemes", nil, &schemes); err != nil {
+		return nil, nil, err
+	}
+	scheme := c.Scheme
+	if len(scheme) == 0 {
+		if len(schemes.Schemes) != 1 {
+			return nil, nil, fmt.Errorf("服务器上的文件使用了%d种哈希方案（%s），请指定其中一种", len(schemes.Schemes), strings.Join(schemes.Schemes, "、"))
+		}
+		scheme = schemes.Schemes[0]
+	}
+	h, err := db.ParseHasher(scheme, c.Secret)
+	return h, schemes.Normalization, err
+}
+
+// 按服务器上的文件所使用的规范化方法的版本对s进行规范化。
+// 各个版本的结果不同时需要发送多个前缀，服务器可以把它们联系起来，所以返回错误
+func normalize(versions []int, s string, fn func(version int, s string) string) (string, error) {
+	if len(versions) == 0 {
+		return fn(db.NormalizationVersion, s), nil
+	}
+	res := fn(versions[0], s)
+	for _, v := range versions[1:] {
+		if fn(v, s) != res {
+			return "", fmt.Errorf("服务器上的文件使用了多个规范化方法的版本，“%s”在各个版本中的写法不同，请按规范的写法输入", s)
+		}
+	}
+	return res, nil
+}
+
+// 按前缀查询，path是接口的路径，input是输入的基本信息或者身份证号，byID表示它是哪一种，fn是对应的规范化方法
+func (c *Client) search(path string, byID bool, input string, fn func(version int, s string) string) ([]*db.RecordInFile, error) {
+	n := c.PrefixLength
+	if n == 0 {
+		n = DefaultPrefixLength
+	}
+	if n < db.MinPrefixLength || n > db.MaxPrefixLength {
+		return nil, fmt.Errorf("哈希值前缀的长度必须在%d到%d位之间：%d", db.MinPrefixLength, db.MaxPrefixLength, n)
+	}
+	h, versions, err := c.hasher()
+	if err != nil {
+		return nil, err
+	}
+	s, err := normalize(versions, input, fn)
+	if err != nil {
+		return nil, err
+	}
+	hash := h.Sum(s)
+	var qr QueryResult
+	if err := c.get(path, url.Values{"prefix": {hex.EncodeToString(hash[:])[:n]}}, &qr); err != nil {
+		return nil, err
+	}
+	res := make([]*db.RecordInFile, 0, 1)
+	for _, j := range qr.Records {
+		rec, err := j.ToRecord()
+		if err != nil {
+			return nil, fmt.Errorf("查询服务返回的记录有误：%s", err.Error())
+		}
+		//哈希值的所有32个字节都必须相等
+		if (byID && rec.IDHash != hash) || (!byID && rec.BaseInfoHash != hash) {
+			continue
+		}
+		found := &db.RecordInFile{Record: *rec, FileName: j.FileName, AgeDays: -1}
+		if j.AgeDays != nil {
+			found.AgeDays = *j.AgeDays
+		}
+		if byID {
+			found.ID = s
+		} else {
+			found.BaseInfo = s
+		}
+		found.Decrypt(h)
+		res = append(res, found)
+	}
+	return res, nil
+}
+
+// 按基本信息的明文进行k-匿名查询，只查询按服务器上的文件所用的版本规范化之后的输入本身，不查询出生年份加一和减一的记录。
+// 需要查询相邻的年份时可以再分别查询，但服务器可能会把这几次查询联系起来
+func (c *Client) SearchBaseInfo(info string) ([]*db.RecordInFile, error) {
+	if err := db.CheckBaseInfo(info); err != nil {
+		return nil, err
+	}
+	return c.search("/range/baseinfo", false, info, db.NormalizeBaseInfoVersion)
+}
+
+// 按身份证号的明文进行k-匿名查询
+func (c *Client) SearchID(id string) ([]*db.RecordInFile, error) {
+	if err := db.CheckID(id); err != nil {
+		return nil, err
+	}
+	return c.search("/range/id", true, id, db.NormalizeIDVersion)
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+func TestRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	yinaoDB := prepareDB(t, dir)
+	defer yinaoDB.Close()
+	h := NewHandler(yinaoDB)
+
+	var schemes SchemesResult
+	code := get(t, h, "/range/schemes", &schemes)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{db.SchemeSHA256}, schemes.Schemes)
+	assert.Equal(t, []int{db.NormalizationVersion}, schemes.Normalization)
+
+	// 服务器只返回哈希值以前缀开头的记录，不知道与之相匹配的明文
+	hash := db.SHA256Hasher.Sum("张若美，女，2018")
+	var res QueryResult
+	code = get(t, h, "/range/baseinfo?prefix="+hex.EncodeToString(hash[:])[:db.MinPrefixLength], &res)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, res.Count >= 1)
+	for _, j := range res.Records {
+		assert.Equal(t, "", j.BaseInfo)
+	}
+
+	// 服务器拒绝太短的前缀，以免有人用几百次查询就取得所有记录
+	for _, prefix := range []string{"a", "zz", hex.EncodeToString(hash[:2]), "zzzzz", strings.Repeat("0", db.MaxPrefixLength+2)} {
+		var errRes ErrorResult
+		code = get(t, h, "/range/id?prefix="+prefix, &errRes)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.NotEqual(t, "", errRes.Error)
+	}
+}
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	yinaoDB := prepareDB(t, dir)
+	defer yinaoDB.Close()
+	ts := httptest.NewServer(NewHandler(yinaoDB))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil)
+	recList, err := c.SearchBaseInfo("张若美， 女，2018")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+	assert.Equal(t, "张若美，女，2018", recList[0].BaseInfo)
+	assert.Equal(t, "江流宛转绕芳甸，月照花林皆似霰。\\n空里流霜不觉飞，汀上白沙看不见。", recList[0].Description)
+
+	// 与直接查询数据库的结果相同
+	expected, err := yinaoDB.SearchBaseInfo("张若美，女，2018")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, expected[0].ToJSON(), recList[0].ToJSON())
+
+	// 不查询出生年份相邻的记录，以免发送一组互相关联的前缀
+	recList, err = c.SearchBaseInfo("张若美，女，2017")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(recList))
+
+	recList, err = c.SearchID("11010920190401961X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+	assert.Equal(t, "11010920190401961X", recList[0].ID)
+
+	recList, err = c.SearchID("11010920170401921X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(recList))
+
+	c.PrefixLength = db.MinPrefixLength - 1
+	_, err = c.SearchID("11010920190401961X")
+	assert.NotEqual(t, nil, err)
+	c.PrefixLength = db.MaxPrefixLength
+	recList, err = c.SearchID("11010920190401961X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+}
+
+func TestClientNormalization(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	// 旧版本的文件中，哈希值是对输入的原文计算的
+	rec := &db.Record{
+		BaseInfoHash: db.SHA256Hasher.Sum("張若美，女，2018"),
+		IDHash:       db.SHA256Hasher.Sum("11010920180401984X"),
+		Confidence:   90,
+		Description:  "江流宛转绕芳甸，月照花林皆似霰。",
+	}
+	rec.Crc32 = crc32.ChecksumIEEE(append(append(rec.BaseInfoHash[:], rec.IDHash[:]...), rec.Description...))
+	var b bytes.Buffer
+	assert.Equal(t, nil, db.WriteRecordsToFileWithHeader(&db.FileHeader{Scheme: db.SchemeSHA256}, []*db.Record{rec}, &b))
+	oldFile := filepath.Join(dir, "old"+db.EncFileSuffix)
+	assert.Equal(t, nil, ioutil.WriteFile(oldFile, b.Bytes(), 0644))
+
+	// 按服务器上的文件所用的版本计算哈希值，而不是本程序的版本
+	oldDB, err := db.NewDBFromFiles([]string{oldFile})
+	assert.Equal(t, nil, err)
+	defer oldDB.Close()
+	ts := httptest.NewServer(NewHandler(oldDB))
+	defer ts.Close()
+	c := NewClient(ts.URL, nil)
+	recList, err := c.SearchBaseInfo("張若美，女，2018")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(recList))
+	recList, err = c.SearchBaseInfo("张若美，女，2018")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(recList))
+
+	// 服务器上的文件使用了多个版本时，只有在各个版本中写法相同的输入才能只发送一个前缀
+	prepareDB(t, dir).Close()
+	mixedDB, err := db.NewDBFromFiles([]string{filepath.Join(dir, "raw"+db.EncFileSuffix), oldFile})
+	assert.Equal(t, nil, err)
+	defer mixedDB.Close()
+	ts2 := httptest.NewServer(NewHandler(mixedDB))
+	defer ts2.Close()
+	c = NewClient(ts2.URL, nil)
+	_, err = c.SearchBaseInfo("張若美，女，2018")
+	assert.Contains(t, err.Error(), "规范化方法的版本")
+	recList, err = c.SearchID("11010920180401984X")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(recList))
+}
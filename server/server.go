@@ -0,0 +1,109 @@
+// server包提供基于HTTP/JSON的查询服务，多台分诊电脑可以共享同一份载入内存的医闹记录
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+// 查询成功时返回的结果
+type QueryResult struct {
+	Count   int              `json:"count"`   // 查询到的记录的条数
+	Records []*db.RecordJSON `json:"records"` // 查询到的记录，按照置信参数排序
+}
+
+// 按前缀查询之前，客户端需要知道服务器上的文件所使用的哈希方案和规范化方法，才能在本地计算哈希值
+type SchemesResult struct {
+	Schemes       []string `json:"schemes"`   // 各个文件所使用的哈希方案
+	Normalization []int    `json:"normalize"` // 各个文件所使用的规范化方法的版本
+}
+
+// 出错时返回的结果
+type ErrorResult struct {
+	Error string `json:"error"` // 错误信息
+}
+
+// 创建查询服务的HTTP处理器，它提供以下接口：
+//
+//	/query/baseinfo?info=姓名，性别，出生年份  按基本信息查询（包括出生年份加一和减一的记录）
+//	/query/id?id=身份证号                     按身份证号查询
+//	/range/schemes                           已载入的文件所使用的哈希方案和规范化方法的版本
+//	/range/baseinfo?prefix=十六进制前缀        返回BaseInfoHash以此开头的所有记录
+//	/range/id?prefix=十六进制前缀              返回IDHash以此开头的所有记录
+//
+// /range下的接口用于k-匿名查询：客户端只发送哈希值的前缀，在本地比较完整的哈希值（见Client），
+// 服务器无法得知查询的是哪一位患者。各个接口都支持GET和POST（表单）方法
+func NewHandler(yinaoDB *db.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query/baseinfo", func(w http.ResponseWriter, r *http.Request) {
+		serveQuery(w, r, "info", db.CheckBaseInfo, yinaoDB.SearchBaseInfo)
+	})
+	mux.HandleFunc("/query/id", func(w http.ResponseWriter, r *http.Request) {
+		serveQuery(w, r, "id", db.CheckID, yinaoDB.SearchID)
+	})
+	mux.HandleFunc("/range/schemes", func(w http.ResponseWriter, r *http.Request) {
+		if !checkMethod(w, r) {
+			return
+		}
+		schemes, versions := yinaoDB.Schemes()
+		writeJSON(w, http.StatusOK, &SchemesResult{Schemes: schemes, Normalization: versions})
+	})
+	mux.HandleFunc("/range/baseinfo", func(w http.ResponseWriter, r *http.Request) {
+		serveQuery(w, r, "prefix", db.CheckHashPrefix, yinaoDB.QueryBaseInfoPrefix)
+	})
+	mux.HandleFunc("/range/id", func(w http.ResponseWriter, r *http.Request) {
+		serveQuery(w, r, "prefix", db.CheckHashPrefix, yinaoDB.QueryIDPrefix)
+	})
+	return mux
+}
+
+// 处理一个查询请求，key是查询参数的名字，check用来检查参数，search用来执行查询
+func serveQuery(w http.ResponseWriter, r *http.Request, key string,
+	check func(string) error, search func(string) ([]*db.RecordInFile, error)) {
+	if !checkMethod(w, r) {
+		return
+	}
+	value := r.FormValue(key)
+	if len(value) == 0 {
+		writeError(w, http.StatusBadRequest, "缺少参数："+key)
+		return
+	}
+	if err := check(value); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recList, err := search(value)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	res := &QueryResult{Count: len(recList), Records: make([]*db.RecordJSON, len(recList))}
+	for i, rec := range recList {
+		res.Records[i] = rec.ToJSON()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// 检查请求的方法，只支持GET和POST
+func checkMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET和POST方法")
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, &ErrorResult{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
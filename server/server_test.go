@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/YinaoBlacklist/YinaoBlacklist/db"
+)
+
+var rawTxt = `
+张若虚，男，2019
+11010920190401961X
+19.0
+春江潮水连海平，海上明月共潮生。
+滟滟随波千万里，何处春江无月明？
+
+张若美，女，2018
+11010920180401984X
+98.0
+江流宛转绕芳甸，月照花林皆似霰。
+空里流霜不觉飞，汀上白沙看不见。`
+
+// 在临时目录中生成一个加密记录文件，并将其载入数据库
+func prepareDB(t *testing.T, dir string) *db.DB {
+	rawFile := filepath.Join(dir, "raw.txt")
+	encFile := filepath.Join(dir, "raw"+db.EncFileSuffix)
+	assert.Equal(t, nil, ioutil.WriteFile(rawFile, []byte(rawTxt), 0644))
+	recList, err := db.ExtractRecordsFromRawFile(rawFile)
+	assert.Equal(t, nil, err)
+	out, err := os.Create(encFile)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, db.WriteRecordsToFile(recList, out))
+	out.Close()
+	yinaoDB, err := db.NewDBFromFiles([]string{encFile})
+	assert.Equal(t, nil, err)
+	return yinaoDB
+}
+
+func get(t *testing.T, h http.Handler, target string, v interface{}) int {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, nil, json.Unmarshal(rr.Body.Bytes(), v))
+	return rr.Code
+}
+
+func TestHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yinao")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+	yinaoDB := prepareDB(t, dir)
+	defer yinaoDB.Close()
+	h := NewHandler(yinaoDB)
+
+	var res QueryResult
+	code := get(t, h, "/query/baseinfo?info="+url.QueryEscape("张若美，女，2017"), &res)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, res.Count)
+	assert.Equal(t, "张若美，女，2018", res.Records[0].BaseInfo)
+	assert.Equal(t, float32(98.0), res.Records[0].Confidence)
+
+	res = QueryResult{}
+	code = get(t, h, "/query/id?id=11010920190401961X", &res)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, res.Count)
+	assert.Equal(t, "11010920190401961X", res.Records[0].ID)
+
+	res = QueryResult{}
+	code = get(t, h, "/query/id?id=11010920170401921X", &res)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0, res.Count)
+
+	var errRes ErrorResult
+	code = get(t, h, "/query/baseinfo?info="+url.QueryEscape("张若美，女2017"), &errRes)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.NotEqual(t, "", errRes.Error)
+
+	errRes = ErrorResult{}
+	code = get(t, h, "/query/id", &errRes)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "缺少参数：id", errRes.Error)
+
+	req := httptest.NewRequest(http.MethodDelete, "/query/id?id=NA", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}